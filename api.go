@@ -0,0 +1,148 @@
+/* JSON API helpers: errors, encoding and request logging */
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+/* Every failing API request is answered with a JSON body like
+ *
+ *  {"code": "target_occupied", "message": "move: illegal move: ..."}
+ *
+ * The code is meant for programs (e.g. the frontend selecting a message for
+ * the user), the message for humans. The HTTP status tells the kind of
+ * failure:
+ *
+ *  400  malformed request: invalid JSON, move notation or layout
+ *  404  unknown endpoint or game
+ *  405  wrong method for the endpoint
+ *  409  request conflicts with the game state: game over, computer thinking
+ *  422  well-formed but illegal move
+ *  500  anything else, a bug on our side
+ *  503  search aborted, as the server is shutting down
+ */
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+/* Generic request errors */
+var errNotFound = &APIError{http.StatusNotFound, "not_found", "not found"}
+var errMethodNotAllowed = &APIError{http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed"}
+var errSearchAborted = &APIError{http.StatusServiceUnavailable, "search_aborted", "search aborted"}
+
+/* Errors of the engine and their HTTP representation, the more specific
+ * errors go first as they wrap the generic ones.
+ */
+var apiErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{ErrOutOfBounds, http.StatusUnprocessableEntity, "out_of_bounds"},
+	{ErrTargetOccupied, http.StatusUnprocessableEntity, "target_occupied"},
+	{ErrNotYourPiece, http.StatusUnprocessableEntity, "not_your_piece"},
+	{ErrTooFar, http.StatusUnprocessableEntity, "too_far"},
+	{ErrIllegalMove, http.StatusUnprocessableEntity, "illegal_move"},
+	{ErrInvalidNotation, http.StatusBadRequest, "invalid_notation"},
+	{ErrGameOver, http.StatusConflict, "game_over"},
+	{ErrSearchRunning, http.StatusConflict, "search_running"},
+}
+
+func (err *APIError) Error() string {
+	return err.Message
+}
+
+/* Wrap an error with the given status and code */
+func NewAPIError(status int, code string, err error) *APIError {
+	return &APIError{status, code, err.Error()}
+}
+
+/* Find the HTTP representation of an error */
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	for _, known := range apiErrors {
+		if errors.Is(err, known.err) {
+			return NewAPIError(known.status, known.code, err)
+		}
+	}
+
+	return NewAPIError(http.StatusInternalServerError, "internal_error", err)
+}
+
+/* Answer a request with an error */
+func writeError(w http.ResponseWriter, err error) {
+	apiErr := toAPIError(err)
+	writeJSON(w, apiErr.Status, apiErr)
+}
+
+/* Decode a JSON request body of at most 1kB.
+ *
+ * Returns io.EOF for an empty body, so callers can choose to accept it.
+ */
+func decodeJSON(r *http.Request, value interface{}) error {
+	decoder := json.NewDecoder(io.LimitReader(r.Body, 1024))
+	if err := decoder.Decode(value); err != nil {
+		if err == io.EOF {
+			return err
+		}
+		return NewAPIError(http.StatusBadRequest, "invalid_json", fmt.Errorf("json: %v", err))
+	}
+
+	return nil
+}
+
+/* Write a JSON response */
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Println("json:", err)
+	}
+}
+
+/* Remembers the status written by a handler, for logging */
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+/* Allow upgrading to WebSocket through the recorder */
+func (recorder *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := recorder.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("http: connection cannot be hijacked")
+	}
+
+	recorder.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+/* Log every request along with its status and duration */
+func logRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{w, http.StatusOK}
+		handler.ServeHTTP(recorder, r)
+
+		log.Printf("%s %s %s %d %v", r.RemoteAddr, r.Method, r.URL.Path, recorder.status, time.Since(start).Round(time.Millisecond))
+	})
+}
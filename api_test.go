@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestAPIErrors(t *testing.T) {
+	store := NewGameStore()
+	id, _, _ := store.Create("", DifficultyLevels[0])
+	finished, _, _ := store.Create("x6/7/7/7/7/7/7 o 0 1", DifficultyLevels[0])
+	thinking, session, _ := store.Create("", DifficultyLevels[0])
+	session.searching = true
+
+	tests := []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		/* Malformed requests */
+		{http.MethodPost, "/games", `{"layout": `, http.StatusBadRequest, "invalid_json"},
+		{http.MethodPost, "/games", `{"layout": "spiral"}`, http.StatusBadRequest, "invalid_layout"},
+		{http.MethodPost, "/games", `{"fen": "x5o/7 x"}`, http.StatusBadRequest, "invalid_layout"},
+		{http.MethodPost, "/games", `{"level": "godlike"}`, http.StatusBadRequest, "invalid_level"},
+		{http.MethodPost, "/games/" + id + "/moves", "", http.StatusBadRequest, "invalid_json"},
+		{http.MethodPost, "/games/" + id + "/moves", `{"move": "z9"}`, http.StatusBadRequest, "invalid_notation"},
+		{http.MethodPost, "/games/" + id + "/moves", `{"move": "a7a4"}`, http.StatusBadRequest, "invalid_notation"},
+		{http.MethodPost, "/games/" + id + "/ply", `{"level": "depth0"}`, http.StatusBadRequest, "invalid_level"},
+
+		/* Unknown games and endpoints */
+		{http.MethodGet, "/games/0123456789abcdef", "", http.StatusNotFound, "not_found"},
+		{http.MethodGet, "/games/" + id + "/board", "", http.StatusNotFound, "not_found"},
+		{http.MethodGet, "/games/" + id + "/moves/1", "", http.StatusNotFound, "not_found"},
+
+		/* Wrong methods */
+		{http.MethodGet, "/games", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{http.MethodPut, "/games/" + id, "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{http.MethodGet, "/games/" + id + "/moves", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{http.MethodGet, "/games/" + id + "/ply", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{http.MethodPost, "/games/" + id + "/pgn", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+
+		/* Conflicts with the state of the game */
+		{http.MethodPost, "/games/" + finished + "/moves", `{"move": "0000"}`, http.StatusConflict, "game_over"},
+		{http.MethodPost, "/games/" + finished + "/ply", "", http.StatusConflict, "game_over"},
+		{http.MethodPost, "/games/" + thinking + "/moves", `{"move": "b6"}`, http.StatusConflict, "search_running"},
+		{http.MethodPost, "/games/" + thinking + "/ply", "", http.StatusConflict, "search_running"},
+
+		/* Illegal moves */
+		{http.MethodPost, "/games/" + id + "/moves", `{"move": "d4"}`, http.StatusUnprocessableEntity, "too_far"},
+		{http.MethodPost, "/games/" + id + "/moves", `{"move": "a1c3"}`, http.StatusUnprocessableEntity, "not_your_piece"},
+		{http.MethodPost, "/games/" + id + "/moves", `{"move": "g7"}`, http.StatusUnprocessableEntity, "target_occupied"},
+		{http.MethodPost, "/games/" + id + "/moves", `{"move": "0000"}`, http.StatusUnprocessableEntity, "illegal_move"},
+	}
+
+	for _, test := range tests {
+		var apiErr APIError
+		recorder := serveGames(store, test.method, test.path, test.body)
+		t.Run(test.method+" "+test.path+" "+test.body, func(t *testing.T) {
+			decodeResponse(t, recorder, test.status, &apiErr)
+			if apiErr.Code != test.code || apiErr.Message == "" {
+				t.Errorf("got %+v, expected code %s", apiErr, test.code)
+			}
+		})
+	}
+
+	/* None of the failed requests changed the games */
+	if view := session.View(); len(view.Moves) != 0 {
+		t.Errorf("moves %v played", view.Moves)
+	}
+	if session, _ := store.Get(id); len(session.View().Moves) != 0 {
+		t.Errorf("moves %v played", session.View().Moves)
+	}
+}
+
+func TestToAPIError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		/* Wrapped errors keep their meaning, the most specific one wins */
+		{fmt.Errorf("move 3: %w", ErrTooFar), http.StatusUnprocessableEntity, "too_far"},
+		{fmt.Errorf("%w: no moves", ErrIllegalMove), http.StatusUnprocessableEntity, "illegal_move"},
+		{fmt.Errorf("%w (1-0)", ErrGameOver), http.StatusConflict, "game_over"},
+		{NewAPIError(http.StatusTeapot, "teapot", errors.New("short and stout")), http.StatusTeapot, "teapot"},
+		{fmt.Errorf("wrapped: %w", errNotFound), http.StatusNotFound, "not_found"},
+		{errSearchAborted, http.StatusServiceUnavailable, "search_aborted"},
+		{errors.New("disk on fire"), http.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, test := range tests {
+		apiErr := toAPIError(test.err)
+		if apiErr.Status != test.status || apiErr.Code != test.code {
+			t.Errorf("%v: %d %s, expected %d %s", test.err, apiErr.Status, apiErr.Code, test.status, test.code)
+		}
+	}
+}
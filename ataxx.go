@@ -76,9 +76,15 @@ import (
  *
  * Ending X's turn.
  *
- * The game continues until neither player is able to move (no empty cells
- * remain). Upon which the player with the most pieces wins. As the grid
- * contains an odd number of cells, there will always be a victor.
+ * A player unable to move passes. The game continues until neither player is
+ * able to move (usually because no empty cells remain), or one of the players
+ * has lost all of its pieces. Upon which the player with the most pieces
+ * wins. Without blocked cells the grid contains an odd number of cells, so a
+ * full board always has a victor.
+ *
+ * Additionally a game is drawn after 100 plies without a single move or
+ * capture, or when the same position occurs for the third time. These rules
+ * need the game history, see AtaxxGame.
  */
 
 /* The 7 by 7 board.
@@ -87,9 +93,13 @@ import (
  *  0 -> empty cell
  *  1 -> player X
  * -1 -> player O
+ *  2 -> blocked cell (gap), never holds a piece
  */
 type AtaxxBoard [7][7]int8
 
+/* Cell value of a blocked cell */
+const BlockedCell int8 = 2
+
 /* This single bitboard type allows us
  * to define some bithacking methods
  * on the standard uint64 type
@@ -98,9 +108,10 @@ type SingleBitboard uint64
 
 /* The 7 by 7 bitboard
  *
- * Two arrays formed by bits.
+ * Three arrays formed by bits.
  * One 49-bit array for all maximizingPlayer pieces.
  * One 49-bit array for all minimizingPlayer pieces.
+ * One 49-bit array for all blocked cells, which stay blocked all game.
  *
  * The arrays follow the same ordering as the original int array board.
  * 7 contiguous bits are a single line of X-coords.
@@ -110,11 +121,22 @@ type SingleBitboard uint64
 type AtaxxBitboard struct {
 	maximizingPlayer SingleBitboard
 	minimizingPlayer SingleBitboard
+	blockers         SingleBitboard
+
+	/* Zobrist key of the pieces and blockers, see Hash */
+	hash uint64
 }
 
 /* Bitboard lookup tables */
 var moveMask, subdivideMask, jumpMask [49]SingleBitboard
 
+/* All 49 cells of the board */
+const fullBoard SingleBitboard = (1 << 49) - 1
+
+/* The leftmost (a) and rightmost (g) column of the board */
+const fileA SingleBitboard = 0x40810204081
+const fileG SingleBitboard = fileA << 6
+
 /* A bitboard for storing board data by player on the move
  * instead of player strategy.
  * This type simplifies a bit of code, and allows us to
@@ -124,66 +146,55 @@ var moveMask, subdivideMask, jumpMask [49]SingleBitboard
 type MoveBitboard struct {
 	movingPlayer  SingleBitboard
 	waitingPlayer SingleBitboard
-}
-
-/* A transposition table for storing Ataxx boards */
-type AtaxxTranspositionTable struct {
-	transpositionMap map[AtaxxTransposition]AtaxxTranspositionResult
-	maxSize          int
+	blockers      SingleBitboard
 }
 
 /* A single Ataxx ply (board + player on turn), used by HTTP server */
 type AtaxxPly struct {
 	Board            AtaxxBoard `json:"board"`
 	MaximizingPlayer bool       `json:"maximizing_player"`
+
+	/* Set by the server once the game has ended */
+	Result GameResult `json:"result,omitempty"`
 }
 
-/* Human player move information */
-type AtaxxPlayerMove struct {
-	State AtaxxPly `json:"state"`
+/* Computer move request, a ply plus the time the computer may think */
+type AtaxxPlyRequest struct {
+	AtaxxPly
 
-	/* Source cell index (7*y + x) */
-	Source int `json:"source"`
+	/* Thinking time in milliseconds, zero selects the default */
+	MoveTime int `json:"move_time"`
 
-	/* Target cell index */
-	Target int `json:"target"`
+	/* Difficulty level, see DifficultyLevels, empty selects the default */
+	Level string `json:"level"`
 }
 
-/* A single Ataxx Transposition */
-type AtaxxTransposition struct {
+/* Computer move response, the resulting ply plus the move played.
+ *
+ * The score is the evaluation in hundredths of a piece, from X's point of
+ * view.
+ */
+type AtaxxPlyResult struct {
 	AtaxxPly
-	depth, alpha, beta int
-}
-
-/* A stored transposition result */
-type AtaxxTranspositionResult struct {
-	resultBoard AtaxxBoard
-	resultScore int
+	Move  string `json:"move"`
+	Score int    `json:"score"`
 }
 
-/* A transposition table for storing AtaxxBit boards */
-type AtaxxBitTranspositionTable struct {
-	transpositionMap map[AtaxxBitTransposition]AtaxxBitTranspositionResult
-	maxSize          int
-}
+/* Human player move information */
+type AtaxxPlayerMove struct {
+	State AtaxxPly `json:"state"`
 
-/* A single AtaxxBit Transposition */
-type AtaxxBitTransposition struct {
-	board              AtaxxBitboard
-	maximizingPlayer   bool
-	depth, alpha, beta int
-}
+	/* Source cell index (7*y + x) */
+	Source int `json:"source"`
 
-/* A stored bit transposition result */
-type AtaxxBitTranspositionResult struct {
-	resultBoard AtaxxBitboard
-	resultScore int
+	/* Target cell index */
+	Target int `json:"target"`
 }
 
 /* Compute Ataxx score
  *
  * This is a simple sumation of all player pieces, since the player with the
- * most pieces wins.
+ * most pieces wins. Blocked cells don't count.
  */
 func (board *AtaxxBoard) Score() (score int) {
 	score = 0
@@ -191,7 +202,9 @@ func (board *AtaxxBoard) Score() (score int) {
 	/* Iterate board */
 	for y := 0; y < 7; y++ {
 		for x := 0; x < 7; x++ {
-			score += int(board[y][x])
+			if board[y][x] != BlockedCell {
+				score += int(board[y][x])
+			}
 		}
 	}
 
@@ -222,6 +235,11 @@ func (board *AtaxxBoard) Score() (score int) {
 func (board *AtaxxBoard) NextBoards(maximizingPlayer bool) []MinimaxableGameboard {
 	results := make([]MinimaxableGameboard, 0)
 
+	/* Game over by elimination or mutual blockade */
+	if board.Finished() {
+		return results
+	}
+
 	var color int8 = 1
 	if !maximizingPlayer {
 		color = -1
@@ -399,19 +417,41 @@ func (board *AtaxxBoard) NextBoards(maximizingPlayer bool) []MinimaxableGameboar
 
 /* Return true if the game is completed
  *
- * in practice this means checking if no empty cells (zeroes) remain.
+ * That is, if one of the players has no pieces left, or if no piece can
+ * reach any empty cell (zeroes). Most commonly because none remain.
  */
 func (board *AtaxxBoard) Finished() bool {
+	hasX, hasO, canMove := false, false, false
+
 	/* Iterate board */
 	for y := 0; y < 7; y++ {
 		for x := 0; x < 7; x++ {
-			if board[y][x] == 0 {
-				return false
+			switch board[y][x] {
+			case 1:
+				hasX = true
+			case -1:
+				hasO = true
+			case 0:
+				/* Look for pieces within jumping distance */
+				for iy := -2; iy <= 2 && !canMove; iy++ {
+					if iy+y < 0 || iy+y >= 7 {
+						continue
+					}
+					for ix := -2; ix <= 2; ix++ {
+						if ix+x < 0 || ix+x >= 7 {
+							continue
+						}
+						if board[iy+y][ix+x] == 1 || board[iy+y][ix+x] == -1 {
+							canMove = true
+							break
+						}
+					}
+				}
 			}
 		}
 	}
 
-	return true
+	return !hasX || !hasO || !canMove
 }
 
 /* Return a freshly initialized game board in starting positions */
@@ -440,7 +480,9 @@ func (board *AtaxxBoard) Print() {
 	/* Iterate board */
 	for y := 0; y < 7; y++ {
 		for x := 0; x < 7; x++ {
-			if board[y][x] > 0 {
+			if board[y][x] == BlockedCell {
+				fmt.Print(" -")
+			} else if board[y][x] > 0 {
 				fmt.Print(" X")
 			} else if board[y][x] < 0 {
 				fmt.Print(" O")
@@ -470,20 +512,29 @@ func (board *AtaxxBoard) ToBitboard() AtaxxBitboard {
 				bit.minimizingPlayer |= maskBit
 				break
 
+			case BlockedCell:
+				bit.blockers |= maskBit
+				break
+
 			default:
 			}
 		}
 	}
+	bit.hash = bit.zobristKey()
 
 	return bit
 }
 
-/* Perform a human player move */
-func HumanMove(game *AtaxxBoard, maximizingPlayer bool, srcX, srcY, tgtX, tgtY int) (bestBoard AtaxxBoard, valid bool) {
+/* Perform a human player move
+ *
+ * Returns one of ErrOutOfBounds, ErrTooFar, ErrTargetOccupied or
+ * ErrNotYourPiece when the move cannot be made.
+ */
+func HumanMove(game *AtaxxBoard, maximizingPlayer bool, srcX, srcY, tgtX, tgtY int) (AtaxxBoard, error) {
 	/* First some sanity checks on the user input */
 	if srcX < 0 || srcX > 6 || tgtX < 0 || tgtX > 6 ||
 		srcY < 0 || srcY > 6 || tgtY < 0 || tgtY > 6 {
-		return *game, false
+		return *game, ErrOutOfBounds
 	}
 
 	dist := func(a, b int) int {
@@ -500,15 +551,15 @@ func HumanMove(game *AtaxxBoard, maximizingPlayer bool, srcX, srcY, tgtX, tgtY i
 
 	/* Secondly make sure cells are actually close enough */
 	if dstX > 2 || dstY > 2 {
-		return *game, false
+		return *game, ErrTooFar
 	}
 
 	/* Is our stone jumping? (movement of more than one cell) */
 	jump := dstX == 2 || dstY == 2
 
-	/* Target cell should not contain piece */
+	/* Target cell should neither contain a piece, nor be blocked */
 	if game[tgtY][tgtX] != 0 {
-		return *game, false
+		return *game, ErrTargetOccupied
 	}
 
 	/* Determine moving player's piece color */
@@ -521,7 +572,7 @@ func HumanMove(game *AtaxxBoard, maximizingPlayer bool, srcX, srcY, tgtX, tgtY i
 
 	/* Source cell should contain our color */
 	if game[srcY][srcX] != color {
-		return *game, false
+		return *game, ErrNotYourPiece
 	}
 
 	/* Move is valid, copy board state and compute output */
@@ -554,42 +605,7 @@ func HumanMove(game *AtaxxBoard, maximizingPlayer bool, srcX, srcY, tgtX, tgtY i
 	infect(tgtX, tgtY)
 
 	/* Finally return resulting board state */
-	return newBoard, true
-}
-
-/* Load a previously computed board from our cache */
-func (table *AtaxxTranspositionTable) Load(game MinimaxableGameboard, maximizingPlayer bool, depth int, alpha int, beta int) (MinimaxableGameboard, int, bool) {
-	key := AtaxxTransposition{AtaxxPly{*(game.(*AtaxxBoard)), maximizingPlayer}, depth, alpha, beta}
-
-	/* Maps return "zero" values, so in our case an empty board and a 0 score */
-	res, found := table.transpositionMap[key]
-	return &res.resultBoard, res.resultScore, found
-}
-
-/* Store a board to the cache
- *
- * This function is where the "magic" happens.
- * For now use an incredibly simple replacement strategy.
- * Whenever our hash table hits the maximum size, we clear the hash table.
- */
-func (table *AtaxxTranspositionTable) Store(game MinimaxableGameboard, maximizingPlayer bool, depth int, alpha int, beta int, resultBoard MinimaxableGameboard, resultScore int) {
-	key := AtaxxTransposition{AtaxxPly{*(game.(*AtaxxBoard)), maximizingPlayer}, depth, alpha, beta}
-
-	/* Clear hash table if we are about to grow past maximum size */
-	if len(table.transpositionMap) == table.maxSize {
-		table.transpositionMap = make(map[AtaxxTransposition]AtaxxTranspositionResult)
-	}
-
-	table.transpositionMap[key] = AtaxxTranspositionResult{*(resultBoard.(*AtaxxBoard)), resultScore}
-}
-
-/* Build a new table with the predefined size */
-func NewTranspositionTable(size int) *AtaxxTranspositionTable {
-	table := AtaxxTranspositionTable{}
-	table.transpositionMap = make(map[AtaxxTransposition]AtaxxTranspositionResult)
-	table.maxSize = size
-
-	return &table
+	return newBoard, nil
 }
 
 /* Score player status.
@@ -604,6 +620,21 @@ func (board *AtaxxBitboard) Score() int {
 	return board.maximizingPlayer.PiecesPlaced() - board.minimizingPlayer.PiecesPlaced()
 }
 
+/* Number of empty cells on the board */
+func (board *AtaxxBitboard) EmptyCells() int {
+	return (^(board.maximizingPlayer | board.minimizingPlayer | board.blockers) & fullBoard).PiecesPlaced()
+}
+
+/* Grow the set bits by one cell in all 8 directions.
+ *
+ * Shifting left or right wraps around to the adjacent row, so the bits
+ * ending up on the opposite edge are masked out.
+ */
+func (board SingleBitboard) Expand() SingleBitboard {
+	horizontal := board | (board<<1)&^fileA | (board>>1)&^fileG
+	return (horizontal | horizontal<<7 | horizontal>>7) & fullBoard
+}
+
 /* Count the number of bits set in a bitboard array.
  *
  * In other words, the number of pieces placed within the array.
@@ -630,6 +661,9 @@ func (board SingleBitboard) PiecesPlaced() int {
  * These are then used for determining wether a move is possible, and then
  * for efficiently computing the new board state.
  *
+ * Like the AtaxxBoard version, a forced pass returns the same board as only
+ * result, and a finished game returns an empty slice.
+ *
  * Arguments:
  *  maximizingPlayer: true if the maximizingPlayer is making the move
  *  false otherwise.
@@ -637,9 +671,8 @@ func (board SingleBitboard) PiecesPlaced() int {
 func (board *AtaxxBitboard) NextBoards(maximizingPlayer bool) []MinimaxableGameboard {
 	results := make([]MinimaxableGameboard, 0)
 
-	/* Handle case where we are finished already */
+	/* Handle case where we are finished already, signalling end of game */
 	if board.Finished() {
-		results = append(results, board)
 		return results
 	}
 
@@ -652,12 +685,13 @@ func (board *AtaxxBitboard) NextBoards(maximizingPlayer bool) []MinimaxableGameb
 		move.movingPlayer = board.minimizingPlayer
 		move.waitingPlayer = board.maximizingPlayer
 	}
+	move.blockers = board.blockers
 
 	//fmt.Println("movingPlayer")
 	//move.movingPlayer.Print()
 	//fmt.Println("waitingPlayer")
 	//move.waitingPlayer.Print()
-	emptyCells := (^(move.movingPlayer | move.waitingPlayer)) & ((1 << 49) - 1)
+	emptyCells := (^(move.movingPlayer | move.waitingPlayer | move.blockers)) & ((1 << 49) - 1)
 	//fmt.Println("emtpyCells")
 	//emptyCells.Print()
 
@@ -739,16 +773,51 @@ func (board *AtaxxBitboard) NextBoards(maximizingPlayer bool) []MinimaxableGameb
 		}
 	}
 
+	/* Return same board state as singular result in case moves remain, but
+	 * current player cannot make them. (forced passed turn)
+	 */
+	if len(results) == 0 {
+		results = append(results, board)
+	}
+
 	return results
 }
 
 /* The game is finished if no more empty cells remain.
  *
- * That is, if both arrays have the first 49 bits set together, the game is
- * over.
+ * That is, if all three arrays have the first 49 bits set together, the game
+ * is over. The game is also over if one of the players has lost all of its
+ * pieces, or if no piece can reach any of the remaining empty cells.
  */
 func (board *AtaxxBitboard) Finished() bool {
-	return (board.maximizingPlayer | board.minimizingPlayer) == ((1 << 49) - 1)
+	emptyCells := ^(board.maximizingPlayer | board.minimizingPlayer | board.blockers) & fullBoard
+	if emptyCells == 0 || board.maximizingPlayer == 0 || board.minimizingPlayer == 0 {
+		return true
+	}
+
+	/* Cells reachable by jumping, including all singles */
+	reachable := (board.maximizingPlayer | board.minimizingPlayer).Expand().Expand()
+	return reachable&emptyCells == 0
+}
+
+/* Outcome of a finished game judging by the board alone.
+ *
+ * Returns ResultNone while the game is not finished, see AtaxxGame for the
+ * rules depending on game history.
+ */
+func (board *AtaxxBitboard) Result() GameResult {
+	if !board.Finished() {
+		return ResultNone
+	}
+
+	score := board.Score()
+	if score > 0 {
+		return ResultXWins
+	} else if score < 0 {
+		return ResultOWins
+	}
+
+	return ResultDraw
 }
 
 /* Initialize bitboard lookup tables */
@@ -794,6 +863,10 @@ func InitBitboards() {
 			 *
 			 * The subdivide mask also doubles as a mask for determining
 			 * infected stones.
+			 *
+			 * Blocked cells need no special treatment here. Pieces may jump
+			 * over them, and as blocked cells never hold pieces they are
+			 * excluded from the empty cells before using the masks.
 			 */
 			for iy := -2; iy <= 2; iy++ {
 				/* Clamp bounds of Y neighbourhood */
@@ -831,9 +904,11 @@ func InitBitboards() {
 					}
 				}
 			}
-			moveMask[maskIndex].Print()
 		}
 	}
+
+	/* Setup hash keys */
+	initZobrist()
 }
 
 /* Conversion function used for simplifying the bitboard next move computation
@@ -841,6 +916,7 @@ func InitBitboards() {
  */
 func (move MoveBitboard) ToMinimaxBoard(maximizingPlayer bool) MinimaxableGameboard {
 	minimax := AtaxxBitboard{}
+	minimax.blockers = move.blockers
 
 	if maximizingPlayer {
 		minimax.maximizingPlayer = move.movingPlayer
@@ -849,6 +925,7 @@ func (move MoveBitboard) ToMinimaxBoard(maximizingPlayer bool) MinimaxableGamebo
 		minimax.maximizingPlayer = move.waitingPlayer
 		minimax.minimizingPlayer = move.movingPlayer
 	}
+	minimax.hash = minimax.zobristKey()
 
 	return &minimax
 }
@@ -858,6 +935,7 @@ func NewBitGame() *AtaxxBitboard {
 	board := AtaxxBitboard{}
 	board.maximizingPlayer = SingleBitboard((1 << 48) | 1)
 	board.minimizingPlayer = SingleBitboard((1 << 42) | (1 << 6))
+	board.hash = board.zobristKey()
 
 	return &board
 }
@@ -872,6 +950,8 @@ func (board *AtaxxBitboard) Print() {
 				fmt.Print(" X")
 			} else if board.minimizingPlayer&maskBit != 0 {
 				fmt.Print(" O")
+			} else if board.blockers&maskBit != 0 {
+				fmt.Print(" -")
 			} else {
 				fmt.Print(" .")
 			}
@@ -893,6 +973,8 @@ func (bit *AtaxxBitboard) ToBoard() AtaxxBoard {
 				board[y][x] = 1
 			} else if bit.minimizingPlayer&maskBit != 0 {
 				board[y][x] = -1
+			} else if bit.blockers&maskBit != 0 {
+				board[y][x] = BlockedCell
 			} else {
 				board[y][x] = 0
 			}
@@ -919,38 +1001,3 @@ func (board SingleBitboard) Print() {
 
 	return
 }
-
-/* Load a previously computed bitboard from our cache */
-func (table *AtaxxBitTranspositionTable) Load(game MinimaxableGameboard, maximizingPlayer bool, depth int, alpha int, beta int) (MinimaxableGameboard, int, bool) {
-	key := AtaxxBitTransposition{*(game.(*AtaxxBitboard)), maximizingPlayer, depth, alpha, beta}
-
-	/* Maps return "zero" values, so in our case an empty board and a 0 score */
-	res, found := table.transpositionMap[key]
-	return &res.resultBoard, res.resultScore, found
-}
-
-/* Store a board to the cache
- *
- * This function is where the "magic" happens.
- * For now use an incredibly simple replacement strategy.
- * Whenever our hash table hits the maximum size, we clear the hash table.
- */
-func (table *AtaxxBitTranspositionTable) Store(game MinimaxableGameboard, maximizingPlayer bool, depth int, alpha int, beta int, resultBoard MinimaxableGameboard, resultScore int) {
-	key := AtaxxBitTransposition{*(game.(*AtaxxBitboard)), maximizingPlayer, depth, alpha, beta}
-
-	/* Clear hash table if we are about to grow past maximum size */
-	if len(table.transpositionMap) == table.maxSize {
-		table.transpositionMap = make(map[AtaxxBitTransposition]AtaxxBitTranspositionResult)
-	}
-
-	table.transpositionMap[key] = AtaxxBitTranspositionResult{*(resultBoard.(*AtaxxBitboard)), resultScore}
-}
-
-/* Build a new table with the predefined size */
-func NewBitTranspositionTable(size int) *AtaxxBitTranspositionTable {
-	table := AtaxxBitTranspositionTable{}
-	table.transpositionMap = make(map[AtaxxBitTransposition]AtaxxBitTranspositionResult)
-	table.maxSize = size
-
-	return &table
-}
@@ -0,0 +1,106 @@
+/* Search benchmark */
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+)
+
+/* Positions searched by the benchmark, from the opening to the ending.
+ *
+ * Changing this list changes the node count of the benchmark, so it should
+ * be left alone unless the signature is meant to change.
+ */
+var benchPositions = []string{
+	StartFEN,
+	"x5o/7/2-1-2/7/2-1-2/7/o5x x 0 1",
+	"x5o/7/3-3/2-1-2/3-3/7/o5x x 0 1",
+	"7/1xx1o2/1xoxoo1/2xxo2/1oxo3/2o4/7 x 0 10",
+	"7/2x1o2/1xxooo1/2xoxx1/2oxo2/3o3/7 o 0 12",
+	"x1o4/xoxo3/ooxx3/1oxxo2/2xooo1/3xo2/6o x 0 18",
+	"xxo1o2/xxoo3/oxxxoo1/ooxxxo1/1oooxx1/2xxo2/4o2 o 0 24",
+	"xxxo1oo/xxoooox/xoxxxoo/ooxxoxx/xoooxxo/oxx1xo1/ooxoxoo o 0 40",
+}
+
+/* Depth searched by default */
+const defaultBenchDepth = 5
+
+/* Entries of the transposition table of every benchmark search */
+const benchTableSize = 1 << 18
+
+/* Result of searching a single benchmark position */
+type BenchResult struct {
+	FEN   string
+	Nodes int
+	Time  time.Duration
+}
+
+/* Search every benchmark position to the given depth.
+ *
+ * Every position is searched by a single thread with a new transposition
+ * table, no opening book and the built-in evaluation, so the node counts only
+ * depend on the search itself and the move generator.
+ */
+func Bench(depth int) ([]BenchResult, error) {
+	results := make([]BenchResult, 0, len(benchPositions))
+	for _, fen := range benchPositions {
+		board, state, err := ParseBitboardFEN(fen)
+		if err != nil {
+			return results, err
+		}
+
+		search := NewSearcher(NewBitTranspositionTable(benchTableSize))
+		search.Weights = &DefaultEvalWeights
+		search.Book, search.Threads = nil, 1
+
+		start := time.Now()
+		search.IterativeDeepening(context.Background(), board, state.MaximizingPlayer, SearchLimits{Depth: depth})
+		results = append(results, BenchResult{fen, search.Nodes(), time.Since(start)})
+	}
+
+	return results, nil
+}
+
+/* Run the bench subcommand
+ *
+ * bench [-depth N]
+ *
+ * Prints the nodes searched per position and in total, the latter serving
+ * as signature of the search: any change to the node count of the same depth
+ * means the search behaves differently.
+ */
+func RunBench(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	depth := flags.Int("depth", defaultBenchDepth, "search depth of every position")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *depth < 1 || *depth > MaxSearchDepth {
+		return errors.New("bench: depth out of range")
+	}
+
+	results, err := Bench(*depth)
+	if err != nil {
+		return err
+	}
+
+	var nodes int
+	var elapsed time.Duration
+	for i, result := range results {
+		fmt.Fprintf(out, "position %d nodes %d time %d fen %s\n", i+1, result.Nodes, result.Time.Milliseconds(), result.FEN)
+		nodes += result.Nodes
+		elapsed += result.Time
+	}
+
+	nps := 0
+	if elapsed > 0 {
+		nps = int(float64(nodes) / elapsed.Seconds())
+	}
+	fmt.Fprintf(out, "nodes %d time %d nps %d\n", nodes, elapsed.Milliseconds(), nps)
+
+	return nil
+}
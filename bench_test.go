@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+)
+
+/* Both board implementations of every bench position */
+func benchBoards(b *testing.B) map[string][]MoveGameboard {
+	boards := map[string][]MoveGameboard{"grid": nil, "bit": nil}
+	for _, fen := range benchPositions {
+		board, _, err := ParseBoardFEN(fen)
+		if err != nil {
+			b.Fatalf("%s: %v", fen, err)
+		}
+		bitboard := board.ToBitboard()
+		boards["grid"] = append(boards["grid"], board)
+		boards["bit"] = append(boards["bit"], &bitboard)
+	}
+
+	return boards
+}
+
+/* Generate the moves of both players in every bench position */
+func BenchmarkMoves(b *testing.B) {
+	for _, name := range []string{"grid", "bit"} {
+		boards := benchBoards(b)[name]
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, board := range boards {
+					board.Moves(true)
+					board.Moves(false)
+				}
+			}
+		})
+	}
+}
+
+/* Generate the boards after every move of both players, see Moves */
+func BenchmarkNextBoards(b *testing.B) {
+	for _, name := range []string{"grid", "bit"} {
+		boards := benchBoards(b)[name]
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, board := range boards {
+					board.NextBoards(true)
+					board.NextBoards(false)
+				}
+			}
+		})
+	}
+}
+
+/* Perform and undo every move of the player to move */
+func BenchmarkMakeMove(b *testing.B) {
+	for _, name := range []string{"grid", "bit"} {
+		boards := benchBoards(b)[name]
+		b.Run(name, func(b *testing.B) {
+			moves := make([][]AtaxxMove, len(boards))
+			for i, board := range boards {
+				moves[i] = board.Moves(true)
+			}
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				for j, board := range boards {
+					for _, move := range moves[j] {
+						board.UnmakeMove(move, true, board.MakeMove(move, true))
+					}
+				}
+			}
+		})
+	}
+}
+
+/* Perft of the starting position, move generation along with making moves */
+func BenchmarkPerft(b *testing.B) {
+	board, state, _ := ParseBoardFEN(StartFEN)
+	bitboard := board.ToBitboard()
+	boards := map[string]MoveGameboard{"grid": board, "bit": &bitboard}
+
+	for _, name := range []string{"grid", "bit"} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Perft(boards[name], state.MaximizingPlayer, 3)
+			}
+		})
+	}
+}
+
+/* Count the pieces of both players in every bench position */
+func BenchmarkPiecesPlaced(b *testing.B) {
+	boards := make([]*AtaxxBitboard, 0, len(benchPositions))
+	for _, fen := range benchPositions {
+		board, _, _ := ParseBitboardFEN(fen)
+		boards = append(boards, board)
+	}
+
+	for i := 0; i < b.N; i++ {
+		for _, board := range boards {
+			board.maximizingPlayer.PiecesPlaced()
+			board.minimizingPlayer.PiecesPlaced()
+		}
+	}
+}
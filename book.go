@@ -0,0 +1,342 @@
+/* Opening books */
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+)
+
+/* An opening book maps positions to moves known to be good there, each with
+ * a weight telling how often it should be played.
+ *
+ * Books are stored as a sequence of 12 byte big-endian entries, sorted by
+ * key and then by descending weight, in the spirit of Polyglot books:
+ *
+ *  key     uint64  Zobrist hash of the position and player to move
+ *  from    uint8   source cell of the move, equal to to for single moves
+ *  to      uint8   target cell of the move
+ *  weight  uint16  relative frequency of the move
+ *
+ * Books are built from game records: every move played in the first plies
+ * of a game is weighted by its outcome for the player who made it, 2 for a
+ * win and 1 for a draw. Moves only leading to losses are left out.
+ */
+type OpeningBook struct {
+	entries map[uint64][]BookMove
+}
+
+/* A move from the book */
+type BookMove struct {
+	Move   AtaxxMove
+	Weight int
+}
+
+/* Size of an entry in a book file */
+const bookEntrySize = 12
+
+/* Book used by the engine, see SetOpeningBook */
+var engineBook *OpeningBook
+
+/* Change the book used by all searches created afterwards, nil disables
+ * the book.
+ */
+func SetOpeningBook(book *OpeningBook) {
+	engineBook = book
+}
+
+/* Create an empty book */
+func NewOpeningBook() *OpeningBook {
+	return &OpeningBook{make(map[uint64][]BookMove)}
+}
+
+/* Read a book file */
+func LoadOpeningBook(path string) (*OpeningBook, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	book, err := ReadOpeningBook(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("book: %s: %v", path, err)
+	}
+	return book, nil
+}
+
+/* Read a book in the binary book format */
+func ReadOpeningBook(in io.Reader) (*OpeningBook, error) {
+	book := NewOpeningBook()
+
+	var entry [bookEntrySize]byte
+	for {
+		if _, err := io.ReadFull(in, entry[:]); err != nil {
+			if err == io.EOF {
+				return book, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				return book, errors.New("truncated entry")
+			}
+			return book, err
+		}
+
+		key := binary.BigEndian.Uint64(entry[0:8])
+		move := AtaxxMove{int8(entry[8]), int8(entry[9])}
+		weight := int(binary.BigEndian.Uint16(entry[10:12]))
+		book.entries[key] = append(book.entries[key], BookMove{move, weight})
+	}
+}
+
+/* Write the book in the binary book format */
+func (book *OpeningBook) Write(out io.Writer) error {
+	keys := make([]uint64, 0, len(book.entries))
+	for key := range book.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	writer := bufio.NewWriter(out)
+	var entry [bookEntrySize]byte
+	for _, key := range keys {
+		moves := append([]BookMove(nil), book.entries[key]...)
+		sort.SliceStable(moves, func(i, j int) bool { return moves[i].Weight > moves[j].Weight })
+		for _, move := range moves {
+			binary.BigEndian.PutUint64(entry[0:8], key)
+			entry[8], entry[9] = uint8(move.Move.From), uint8(move.Move.To)
+			binary.BigEndian.PutUint16(entry[10:12], uint16(move.Weight))
+			writer.Write(entry[:])
+		}
+	}
+
+	return writer.Flush()
+}
+
+/* Store the book as file, readable by LoadOpeningBook */
+func (book *OpeningBook) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = book.Write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+/* Number of positions in the book */
+func (book *OpeningBook) Len() int {
+	return len(book.entries)
+}
+
+/* Add weight to a move in a position */
+func (book *OpeningBook) Add(board *AtaxxBitboard, maximizingPlayer bool, move AtaxxMove, weight int) {
+	key := board.Hash(maximizingPlayer)
+	moves := book.entries[key]
+	for i := range moves {
+		if moves[i].Move == move {
+			moves[i].Weight += weight
+			return
+		}
+	}
+	book.entries[key] = append(moves, BookMove{move, weight})
+}
+
+/* Book moves for a position, best first. Moves not legal in the position,
+ * e.g. due to a hash collision, are left out.
+ */
+func (book *OpeningBook) Moves(board *AtaxxBitboard, maximizingPlayer bool) []BookMove {
+	moves := make([]BookMove, 0)
+	for _, move := range book.entries[board.Hash(maximizingPlayer)] {
+		if move.Weight > 0 && isLegalMove(board, maximizingPlayer, move.Move) {
+			moves = append(moves, move)
+		}
+	}
+	sort.SliceStable(moves, func(i, j int) bool { return moves[i].Weight > moves[j].Weight })
+
+	return moves
+}
+
+/* Pick a book move with probability proportional to its weight */
+func (book *OpeningBook) Probe(board *AtaxxBitboard, maximizingPlayer bool) (AtaxxMove, bool) {
+	moves := book.Moves(board, maximizingPlayer)
+
+	total := 0
+	for _, move := range moves {
+		total += move.Weight
+	}
+	if total == 0 {
+		return PassMove, false
+	}
+
+	pick := rand.Intn(total)
+	for _, move := range moves {
+		pick -= move.Weight
+		if pick < 0 {
+			return move.Move, true
+		}
+	}
+
+	return moves[0].Move, true
+}
+
+/* Play book moves from a position for at most the given number of plies,
+ * returning the resulting position as FEN and the number of moves played.
+ */
+func (book *OpeningBook) Walk(fen string, plies int) (string, int, error) {
+	game, err := NewAtaxxGame(fen)
+	if err != nil {
+		return fen, 0, err
+	}
+
+	played := 0
+	for ; played < plies && game.Result() == ResultNone; played++ {
+		move, ok := book.Probe(&game.Board, game.MaximizingPlayer)
+		if !ok {
+			break
+		}
+		if err := game.Play(move); err != nil {
+			return fen, 0, err
+		}
+	}
+
+	return game.FEN(), played, nil
+}
+
+/* Keep only the book moves that are played and scored often enough, and
+ * scale down weights so they fit in the book file.
+ */
+func (book *OpeningBook) prune(minWeight int) {
+	maxWeight := 0
+	for key, moves := range book.entries {
+		kept := moves[:0]
+		for _, move := range moves {
+			if move.Weight >= minWeight && move.Weight > 0 {
+				kept = append(kept, move)
+				if move.Weight > maxWeight {
+					maxWeight = move.Weight
+				}
+			}
+		}
+		if len(kept) == 0 {
+			delete(book.entries, key)
+		} else {
+			book.entries[key] = kept
+		}
+	}
+
+	if divisor := maxWeight/0xffff + 1; divisor > 1 {
+		for _, moves := range book.entries {
+			for i := range moves {
+				moves[i].Weight = (moves[i].Weight + divisor - 1) / divisor
+			}
+		}
+	}
+}
+
+/* Build a book from the first plies of the given games, keeping moves with
+ * at least minWeight.
+ */
+func BuildOpeningBook(games []*GameRecord, plies int, minWeight int) (*OpeningBook, error) {
+	book := NewOpeningBook()
+
+	for _, record := range games {
+		if record.Result == ResultNone {
+			continue
+		}
+		game, err := NewAtaxxGame(record.StartFEN())
+		if err != nil {
+			return nil, err
+		}
+
+		for ply, recorded := range record.Moves {
+			move := recorded.Move
+			if ply >= plies || game.Result() != ResultNone {
+				break
+			}
+
+			weight := 1
+			if record.Result != ResultDraw {
+				weight = 0
+				if (record.Result == ResultXWins) == game.MaximizingPlayer {
+					weight = 2
+				}
+			}
+			if move != PassMove {
+				book.Add(&game.Board, game.MaximizingPlayer, move, weight)
+			}
+
+			if err := game.Play(move); err != nil {
+				return nil, fmt.Errorf("book: game from %s: %v", record.StartFEN(), err)
+			}
+		}
+	}
+	book.prune(minWeight)
+
+	return book, nil
+}
+
+/* Run the book subcommand
+ *
+ * book -games FILE [-plies N] [-min W] -out FILE
+ * book -book FILE [-fen FEN]
+ *
+ * The first form builds a book from game records, see GameRecord, the
+ * second lists the book moves of a position.
+ */
+func RunBook(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("book", flag.ContinueOnError)
+	gamesFile := flags.String("games", "", "build a book from the games in file")
+	plies := flags.Int("plies", 12, "number of plies of every game to add")
+	minWeight := flags.Int("min", 2, "minimum weight of a move to keep it")
+	outFile := flags.String("out", "", "write the built book to file")
+	bookFile := flags.String("book", "", "list moves from this book")
+	fen := flags.String("fen", StartFEN, "position to list moves for")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	switch {
+	case *gamesFile != "" && *outFile != "":
+		file, err := os.Open(*gamesFile)
+		if err != nil {
+			return err
+		}
+		games, err := ReadGameRecords(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+
+		book, err := BuildOpeningBook(games, *plies, *minWeight)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%d positions from %d games\n", book.Len(), len(games))
+		return book.Save(*outFile)
+
+	case *bookFile != "":
+		book, err := LoadOpeningBook(*bookFile)
+		if err != nil {
+			return err
+		}
+		board, state, err := ParseBitboardFEN(*fen)
+		if err != nil {
+			return err
+		}
+		for _, move := range book.Moves(board, state.MaximizingPlayer) {
+			fmt.Fprintf(out, "%v %d\n", move.Move, move.Weight)
+		}
+		return nil
+	}
+
+	return errors.New("book: need -games and -out to build, or -book to list")
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+/* Parse moves, failing the test on malformed notation */
+func parseMoves(t *testing.T, notations ...string) []AtaxxMove {
+	t.Helper()
+	moves := make([]AtaxxMove, len(notations))
+	for i, notation := range notations {
+		move, err := ParseMove(notation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		moves[i] = move
+	}
+	return moves
+}
+
+func TestOpeningBookRoundTrip(t *testing.T) {
+	start := NewBitGame()
+	moves := parseMoves(t, "b6", "f2", "a7c7", "g7e7", "0000")
+	after := *start
+	after.MakeMove(moves[0], true)
+
+	book := NewOpeningBook()
+	book.Add(start, true, moves[0], 1)
+	book.Add(start, true, moves[1], 3)
+	book.Add(start, true, moves[2], 4)
+	book.Add(start, true, moves[1], 2)
+	book.Add(&after, false, moves[3], 7)
+	book.Add(&after, false, moves[4], 1)
+
+	/* Same-key entries are written by descending weight */
+	var file bytes.Buffer
+	if err := book.Write(&file); err != nil {
+		t.Fatal(err)
+	}
+	if file.Len() != 5*bookEntrySize {
+		t.Fatalf("%d bytes, expected %d entries", file.Len(), 5)
+	}
+	startKey := start.Hash(true)
+	var weights []int
+	for entry := file.Bytes(); len(entry) > 0; entry = entry[bookEntrySize:] {
+		if binary.BigEndian.Uint64(entry) == startKey {
+			weights = append(weights, int(binary.BigEndian.Uint16(entry[10:])))
+		}
+	}
+	if !reflect.DeepEqual(weights, []int{5, 4, 1}) {
+		t.Errorf("weights of the starting position %v, expected 5, 4, 1", weights)
+	}
+
+	/* Read back, from memory and from file */
+	path := filepath.Join(t.TempDir(), "book.bin")
+	if err := book.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadOpeningBook(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadOpeningBook(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, book := range map[string]*OpeningBook{"read": read, "loaded": loaded} {
+		if book.Len() != 2 {
+			t.Errorf("%s: %d positions", name, book.Len())
+		}
+		expected := []BookMove{{moves[1], 5}, {moves[2], 4}, {moves[0], 1}}
+		if got := book.Moves(start, true); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: moves %v, expected %v", name, got, expected)
+		}
+
+		/* The pass is kept in the file, but is not legal here */
+		expected = []BookMove{{moves[3], 7}}
+		if got := book.Moves(&after, false); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: moves after b6 %v, expected %v", name, got, expected)
+		}
+		if move, found := book.Probe(&after, false); !found || move != moves[3] {
+			t.Errorf("%s: probed %v, %t", name, move, found)
+		}
+
+		/* Unknown positions and the other side to move */
+		if move, found := book.Probe(start, false); found {
+			t.Errorf("%s: probed %v for O", name, move)
+		}
+	}
+}
+
+/* Every weighted move is probed some time */
+func TestOpeningBookProbe(t *testing.T) {
+	start := NewBitGame()
+	book := NewOpeningBook()
+	for _, move := range parseMoves(t, "b6", "f2", "a7c7") {
+		book.Add(start, true, move, 1)
+	}
+
+	probed := make(map[AtaxxMove]bool)
+	for i := 0; i < 200; i++ {
+		move, found := book.Probe(start, true)
+		if !found {
+			t.Fatal("no move found")
+		}
+		probed[move] = true
+	}
+	if len(probed) != 3 {
+		t.Errorf("probed only %v", probed)
+	}
+}
+
+func TestReadOpeningBookTruncated(t *testing.T) {
+	if _, err := ReadOpeningBook(bytes.NewReader(make([]byte, bookEntrySize+5))); err == nil {
+		t.Error("truncated book accepted")
+	}
+}
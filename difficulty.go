@@ -0,0 +1,205 @@
+/* Difficulty levels for the computer opponent */
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* A difficulty level determines how the computer picks its moves:
+ *  - A Random level plays any legal move.
+ *  - Otherwise the position is searched to a fixed Depth (in plies), or for
+ *    the requested thinking time when Depth is zero.
+ *  - With a non-zero Temperature every root move is scored, and the move is
+ *    drawn from a softmax distribution over those scores. The higher the
+ *    temperature (in pieces), the more likely a weaker move is played, small
+ *    blunders being far more likely than big ones.
+ */
+type Difficulty struct {
+	Name        string
+	Random      bool
+	Depth       int
+	Temperature float64
+}
+
+/* Named difficulty levels, from weak to strong.
+ *
+ * Besides these "depth1" up to "depth64" select plain fixed depth search.
+ */
+var DifficultyLevels = []Difficulty{
+	{"random", true, 0, 0},
+	{"greedy", false, 1, 0},
+	{"beginner", false, 1, 2.0},
+	{"easy", false, 2, 1.0},
+	{"medium", false, 3, 0.5},
+	{"hard", false, 4, 0},
+	{"timed", false, 0, 0},
+}
+
+/* Level used when none is requested, full strength within the time limit */
+const DefaultDifficulty = "timed"
+
+/* Lookup a difficulty level by name, an empty name selects the default */
+func ParseDifficulty(name string) (Difficulty, error) {
+	if name == "" {
+		name = DefaultDifficulty
+	}
+
+	for _, level := range DifficultyLevels {
+		if level.Name == name {
+			return level, nil
+		}
+	}
+
+	if strings.HasPrefix(name, "depth") {
+		depth, err := strconv.Atoi(strings.TrimPrefix(name, "depth"))
+		if err == nil && depth >= 1 && depth <= MaxSearchDepth {
+			return Difficulty{name, false, depth, 0}, nil
+		}
+	}
+
+	return Difficulty{}, fmt.Errorf("difficulty: unknown level %q", name)
+}
+
+/* Pick a move for the player to move at this difficulty level, using the
+ * given searcher. Its OnInfo callback is called at least once, with the
+ * move actually chosen.
+ *
+ * moveTime only applies to levels without a fixed depth, which are the only
+ * ones to use the opening book and the endgame solver. The move and score
+ * of the result are those actually played, so the score may be worse than
+ * the best score the search found.
+ */
+func (level Difficulty) ChooseMove(ctx context.Context, searcher *Searcher, game MoveGameboard, maximizingPlayer bool, moveTime time.Duration) SearchResult {
+	start := time.Now()
+
+	moves := game.Moves(maximizingPlayer)
+	if len(moves) == 0 {
+		return SearchResult{Move: PassMove, Score: searcher.evaluate(game)}
+	}
+
+	if level.Random {
+		move := moves[rand.Intn(len(moves))]
+		captured := game.MakeMove(move, maximizingPlayer)
+		score := searcher.evaluate(game)
+		game.UnmakeMove(move, maximizingPlayer, captured)
+
+		result := SearchResult{Move: move, Score: score, Depth: 1,
+			Info: SearchInfo{Depth: 1, SelDepth: 1, Score: score, PV: []AtaxxMove{move}, Time: time.Since(start)}}
+		if searcher.OnInfo != nil {
+			searcher.OnInfo(result.Info)
+		}
+		return result
+	}
+
+	if level.Temperature == 0 && level.Depth == 0 {
+		return searcher.IterativeDeepening(ctx, game, maximizingPlayer, SearchLimits{MoveTime: moveTime})
+	}
+	if level.Temperature == 0 {
+		/* The book and the solver would play far beyond the depth of
+		 * the level, so fixed depths do without them.
+		 */
+		book, solveEmpty := searcher.Book, searcher.SolveEmpty
+		searcher.Book, searcher.SolveEmpty = nil, 0
+		defer func() {
+			searcher.Book, searcher.SolveEmpty = book, solveEmpty
+		}()
+		return searcher.IterativeDeepening(ctx, game, maximizingPlayer, SearchLimits{Depth: level.Depth})
+	}
+
+	/* Weaken play by sampling from the scores of all root moves */
+	scored := searcher.scoreMoves(ctx, game, maximizingPlayer, level.Depth)
+	choice := softmaxChoice(scored, maximizingPlayer, level.Temperature)
+	elapsed := time.Since(start)
+
+	result := SearchResult{Move: choice.Move, Score: choice.Score, Depth: level.Depth, Incomplete: ctx.Err() != nil}
+	result.Info = SearchInfo{Depth: level.Depth, SelDepth: searcher.selDepth, Score: choice.Score,
+		PV: []AtaxxMove{choice.Move}, Nodes: searcher.nodes, Time: elapsed}
+	if elapsed > 0 {
+		result.Info.NPS = int(float64(searcher.nodes) / elapsed.Seconds())
+	}
+	if searcher.OnInfo != nil && !result.Incomplete {
+		searcher.OnInfo(result.Info)
+	}
+
+	return result
+}
+
+/* A root move along with its search score */
+type ScoredMove struct {
+	Move  AtaxxMove
+	Score int
+}
+
+/* Score every move of the player to move by searching depth plies, the
+ * move itself included.
+ */
+func (search *Searcher) scoreMoves(ctx context.Context, game MoveGameboard, maximizingPlayer bool, depth int) []ScoredMove {
+	search.done = ctx.Done()
+	search.interruptible = true
+
+	moves := game.Moves(maximizingPlayer)
+	scored := make([]ScoredMove, 0, len(moves))
+	for _, move := range moves {
+		captured := search.makeMove(game, move, maximizingPlayer)
+		score := search.leafScore(game, search.ply)
+		if depth > 1 && !game.Finished() {
+			/* Search depth 0 already looks one ply ahead */
+			_, score = search.alphaBeta(game, !maximizingPlayer, depth-2, -ScoreInfinity, ScoreInfinity)
+		}
+		search.unmakeMove(game, move, maximizingPlayer, captured)
+
+		if search.stopped {
+			break
+		}
+		scored = append(scored, ScoredMove{move, score})
+	}
+
+	/* Out of time before anything was scored, any move will do */
+	if len(scored) == 0 {
+		scored = append(scored, ScoredMove{moves[0], 0})
+	}
+
+	return scored
+}
+
+/* Draw a move with probability proportional to exp(score / temperature),
+ * scores taken from the point of view of the player to move.
+ */
+func softmaxChoice(scored []ScoredMove, maximizingPlayer bool, temperature float64) ScoredMove {
+	/* Best first, for numerical stability and deterministic tie order */
+	sort.SliceStable(scored, func(i, j int) bool {
+		if maximizingPlayer {
+			return scored[i].Score > scored[j].Score
+		}
+		return scored[i].Score < scored[j].Score
+	})
+	best := float64(scored[0].Score)
+
+	weights := make([]float64, len(scored))
+	total := 0.0
+	for i, move := range scored {
+		advantage := float64(move.Score) - best
+		if !maximizingPlayer {
+			advantage = -advantage
+		}
+		weights[i] = math.Exp(advantage / (temperature * PieceValue))
+		total += weights[i]
+	}
+
+	pick := rand.Float64() * total
+	for i, weight := range weights {
+		pick -= weight
+		if pick < 0 {
+			return scored[i]
+		}
+	}
+
+	return scored[0]
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+/* Moves ending the game are scored by their result, not the evaluation */
+func TestScoreMovesFinished(t *testing.T) {
+	board, _, _ := ParseBitboardFEN("xo5/7/7/7/7/7/7 x 0 1")
+	for _, depth := range []int{1, 2, 3} {
+		search := NewSearcher(nil)
+		for _, scored := range search.scoreMoves(context.Background(), board, true, depth) {
+			child := *board
+			child.MakeMove(scored.Move, true)
+			if child.Finished() && scored.Score != resultScore(child.Score(), 1) {
+				t.Errorf("depth %d: %v scores %d, expected %d", depth, scored.Move, scored.Score, resultScore(child.Score(), 1))
+			} else if !child.Finished() && depth == 1 && ProvenScore(scored.Score) {
+				t.Errorf("depth %d: %v scores %d", depth, scored.Move, scored.Score)
+			}
+		}
+	}
+}
+
+func TestParseDifficulty(t *testing.T) {
+	tests := []struct {
+		name  string
+		depth int
+		ok    bool
+	}{
+		{"", 0, true},
+		{"timed", 0, true},
+		{"hard", 4, true},
+		{"depth1", 1, true},
+		{"depth64", MaxSearchDepth, true},
+		{"depth0", 0, false},
+		{"depth65", 0, false},
+		{"depth-1", 0, false},
+		{"depth", 0, false},
+		{"depthx", 0, false},
+		{"Hard", 0, false},
+		{"godlike", 0, false},
+	}
+
+	for _, test := range tests {
+		level, err := ParseDifficulty(test.name)
+		if (err == nil) != test.ok {
+			t.Errorf("%q: error %v", test.name, err)
+		} else if test.ok && level.Depth != test.depth {
+			t.Errorf("%q: depth %d, expected %d", test.name, level.Depth, test.depth)
+		}
+	}
+}
+
+/* Both sides prefer their own best move, and a low temperature all but
+ * rules out the others.
+ */
+func TestSoftmaxChoice(t *testing.T) {
+	moves := parseMoves(t, "b6", "f2", "a7c7")
+	for _, maximizingPlayer := range []bool{true, false} {
+		best, worst := moves[0], moves[2]
+		if !maximizingPlayer {
+			best, worst = worst, best
+		}
+
+		counts := make(map[AtaxxMove]int)
+		for i := 0; i < 1000; i++ {
+			scored := []ScoredMove{{moves[2], -PieceValue}, {moves[0], PieceValue}, {moves[1], 0}}
+			counts[softmaxChoice(scored, maximizingPlayer, 1).Move]++
+		}
+		if counts[best] <= counts[moves[1]] || counts[moves[1]] <= counts[worst] {
+			t.Errorf("maximizing %t: picked %v", maximizingPlayer, counts)
+		}
+
+		for i := 0; i < 100; i++ {
+			scored := []ScoredMove{{moves[2], -PieceValue}, {moves[0], PieceValue}, {moves[1], 0}}
+			if move := softmaxChoice(scored, maximizingPlayer, 0.01).Move; move != best {
+				t.Fatalf("maximizing %t: picked %v at low temperature", maximizingPlayer, move)
+			}
+		}
+	}
+}
+
+/* Fixed depth levels leave the book alone, the timed level plays from it */
+func TestChooseMoveBook(t *testing.T) {
+	board := NewBitGame()
+	book := NewOpeningBook()
+	book.Add(board, true, parseMoves(t, "a7c7")[0], 1)
+
+	for _, name := range []string{"greedy", "hard", "timed"} {
+		level, _ := ParseDifficulty(name)
+		search := NewSearcher(NewBitTranspositionTable(1 << 12))
+		search.Book, search.Threads = book, 1
+		result := level.ChooseMove(context.Background(), search, board, true, 10*time.Millisecond)
+
+		if result.Book != (level.Depth == 0) {
+			t.Errorf("%s: book move %t", name, result.Book)
+		}
+		if search.Book != book || search.SolveEmpty != DefaultSolveEmpty {
+			t.Errorf("%s: searcher settings changed", name)
+		}
+	}
+}
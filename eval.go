@@ -0,0 +1,180 @@
+/* Position evaluation */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+/* The evaluation estimates how good a position is for player X, in
+ * hundredths of a piece. It is a weighted sum of features, each feature
+ * being the difference between X's and O's count:
+ *
+ *  material:      pieces on the board.
+ *  mobility:      empty cells the player can move to.
+ *  frontier:      pieces next to an empty cell the opponent can move to,
+ *                 i.e. pieces the opponent may capture on its next move.
+ *  safe:          pieces without empty neighbours, which cannot be
+ *                 captured for now.
+ *  piece-square:  a bonus per cell holding a piece. The table is given from
+ *                 X's point of view, O uses it mirrored left to right, as the
+ *                 starting positions mirror each other that way.
+ *
+ * As the evaluation is linear in the weights, the features are exposed on
+ * their own for tuning the weights.
+ */
+
+/* Score of a single piece, the unit of search scores */
+const PieceValue = 100
+
+/* Evaluation weights, in hundredths of a piece per feature */
+type EvalWeights struct {
+	Material    int     `json:"material"`
+	Mobility    int     `json:"mobility"`
+	Frontier    int     `json:"frontier"`
+	Safe        int     `json:"safe"`
+	PieceSquare [49]int `json:"piece_square"`
+}
+
+/* Feature counts of a position, X's count minus O's */
+type EvalFeatures struct {
+	Material    int
+	Mobility    int
+	Frontier    int
+	Safe        int
+	PieceSquare [49]int
+}
+
+/* Weights used unless configured otherwise */
+var DefaultEvalWeights = EvalWeights{Material: PieceValue, Mobility: 2, Frontier: -5, Safe: 3}
+
+/* Weights counting material only, equivalent to the plain Score */
+var MaterialEvalWeights = EvalWeights{Material: PieceValue}
+
+/* Weights used by the engine, see SetEvalWeights */
+var engineEvalWeights = DefaultEvalWeights
+
+/* Change the weights used by all searches created afterwards */
+func SetEvalWeights(weights EvalWeights) {
+	engineEvalWeights = weights
+}
+
+/* Load weights from a JSON file.
+ *
+ * Weights missing from the file keep their default value.
+ */
+func LoadEvalWeights(path string) (EvalWeights, error) {
+	weights := DefaultEvalWeights
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return weights, err
+	}
+	if err := json.Unmarshal(data, &weights); err != nil {
+		return weights, fmt.Errorf("eval: %s: %v", path, err)
+	}
+
+	return weights, nil
+}
+
+/* Write weights as JSON, readable by LoadEvalWeights */
+func (weights *EvalWeights) Write(out io.Writer) error {
+	data, err := json.MarshalIndent(weights, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(append(data, '\n'))
+	return err
+}
+
+/* Store weights as JSON file, readable by LoadEvalWeights */
+func (weights *EvalWeights) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = weights.Write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+/* Mirror a cell index left to right */
+func mirrorCell(cell int) int {
+	return cell - cell%7 + 6 - cell%7
+}
+
+/* Count the features of a position */
+func (board *AtaxxBitboard) Features() (features EvalFeatures) {
+	x, o := board.maximizingPlayer, board.minimizingPlayer
+	empty := fullBoard &^ (x | o | board.blockers)
+
+	/* Pieces next to empty cells, and those the opponent can capture */
+	var xFrontier, oFrontier, xExposed, oExposed SingleBitboard
+	for cells := empty; cells != 0; cells &= cells - 1 {
+		cell := cells.FirstCell()
+
+		xReach := x&moveMask[cell] != 0
+		oReach := o&moveMask[cell] != 0
+		if xReach {
+			features.Mobility++
+		}
+		if oReach {
+			features.Mobility--
+		}
+
+		xFrontier |= x & subdivideMask[cell]
+		oFrontier |= o & subdivideMask[cell]
+		if oReach {
+			xExposed |= x & subdivideMask[cell]
+		}
+		if xReach {
+			oExposed |= o & subdivideMask[cell]
+		}
+	}
+
+	features.Material = x.PiecesPlaced() - o.PiecesPlaced()
+	features.Frontier = xExposed.PiecesPlaced() - oExposed.PiecesPlaced()
+	features.Safe = (x &^ xFrontier).PiecesPlaced() - (o &^ oFrontier).PiecesPlaced()
+
+	for pieces := x; pieces != 0; pieces &= pieces - 1 {
+		features.PieceSquare[pieces.FirstCell()]++
+	}
+	for pieces := o; pieces != 0; pieces &= pieces - 1 {
+		features.PieceSquare[mirrorCell(pieces.FirstCell())]--
+	}
+
+	return features
+}
+
+/* Evaluate a position for player X.
+ *
+ * Finished games are scored by material alone, as nothing else matters
+ * anymore.
+ */
+func (weights *EvalWeights) Evaluate(board *AtaxxBitboard) int {
+	if board.Finished() {
+		return weights.Material * board.Score()
+	}
+
+	features := board.Features()
+	return weights.Apply(&features)
+}
+
+/* Weighted sum of features */
+func (weights *EvalWeights) Apply(features *EvalFeatures) int {
+	score := weights.Material*features.Material +
+		weights.Mobility*features.Mobility +
+		weights.Frontier*features.Frontier +
+		weights.Safe*features.Safe
+	for cell, count := range features.PieceSquare {
+		score += weights.PieceSquare[cell] * count
+	}
+
+	return score
+}
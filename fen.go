@@ -0,0 +1,193 @@
+/* FEN position notation for Ataxx boards */
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/* Ataxx FEN describes a position in a single line of text, e.g. the
+ * starting position:
+ *
+ *  x5o/7/7/7/7/7/o5x x 0 1
+ *
+ * The string consists of up to four space separated fields:
+ *  1. The board, ranks listed from 7 down to 1, files from a to g.
+ *     'x' and 'o' are player pieces, '-' is a blocked square and
+ *     digits 1-7 denote that many consecutive empty squares.
+ *  2. The side to move, 'x' or 'o'.
+ *  3. The halfmove clock, optional, defaults to 0.
+ *  4. The fullmove number, optional, defaults to 1.
+ *
+ * Player X is our maximizingPlayer, player O our minimizingPlayer.
+ * The first rank in the string (rank 7) corresponds to row 0 of the board.
+ */
+
+/* FEN of the standard starting position */
+const StartFEN = "x5o/7/7/7/7/7/o5x x 0 1"
+
+/* Named starting layouts.
+ *
+ * Besides the standard empty board, tournaments commonly use a number of
+ * symmetric layouts with blocked cells (gaps).
+ */
+var StartingLayouts = map[string]string{
+	"standard": StartFEN,
+	"gaps":     "x5o/7/2-1-2/7/2-1-2/7/o5x x 0 1",
+	"cross":    "x5o/7/3-3/2-1-2/3-3/7/o5x x 0 1",
+	"center":   "x5o/7/2-1-2/3-3/2-1-2/7/o5x x 0 1",
+	"corners":  "x5o/1-3-1/7/7/7/1-3-1/o5x x 0 1",
+}
+
+/* Game state stored in a FEN string besides the board itself */
+type AtaxxFENState struct {
+	MaximizingPlayer bool
+	HalfmoveClock    int
+	FullmoveNumber   int
+}
+
+/* Parse a FEN string into a board and the accompanying game state */
+func ParseBoardFEN(fen string) (*AtaxxBoard, AtaxxFENState, error) {
+	board := AtaxxBoard{}
+	state := AtaxxFENState{true, 0, 1}
+
+	fields := strings.Fields(fen)
+	if len(fields) < 2 || len(fields) > 4 {
+		return nil, state, fmt.Errorf("fen: expected 2 to 4 fields, got %d", len(fields))
+	}
+
+	/* Board field */
+	ranks := strings.Split(fields[0], "/")
+	if len(ranks) != 7 {
+		return nil, state, fmt.Errorf("fen: expected 7 ranks, got %d", len(ranks))
+	}
+	for y, rank := range ranks {
+		x := 0
+		for _, c := range rank {
+			if x >= 7 {
+				return nil, state, fmt.Errorf("fen: rank %d has more than 7 files", 7-y)
+			}
+			switch {
+			case c == 'x' || c == 'X':
+				board[y][x] = 1
+				x++
+			case c == 'o' || c == 'O':
+				board[y][x] = -1
+				x++
+			case c == '-':
+				board[y][x] = BlockedCell
+				x++
+			case c >= '1' && c <= '7':
+				x += int(c - '0')
+			default:
+				return nil, state, fmt.Errorf("fen: invalid character %q in rank %d", c, 7-y)
+			}
+		}
+		if x != 7 {
+			return nil, state, fmt.Errorf("fen: rank %d has %d files instead of 7", 7-y, x)
+		}
+	}
+
+	/* Side to move */
+	switch fields[1] {
+	case "x", "X":
+		state.MaximizingPlayer = true
+	case "o", "O":
+		state.MaximizingPlayer = false
+	default:
+		return nil, state, fmt.Errorf("fen: invalid side to move %q", fields[1])
+	}
+
+	/* Optional move counters */
+	if len(fields) > 2 {
+		clock, err := strconv.Atoi(fields[2])
+		if err != nil || clock < 0 {
+			return nil, state, fmt.Errorf("fen: invalid halfmove clock %q", fields[2])
+		}
+		state.HalfmoveClock = clock
+	}
+	if len(fields) > 3 {
+		number, err := strconv.Atoi(fields[3])
+		if err != nil || number < 1 {
+			return nil, state, fmt.Errorf("fen: invalid fullmove number %q", fields[3])
+		}
+		state.FullmoveNumber = number
+	}
+
+	return &board, state, nil
+}
+
+/* Parse a FEN string into a bitboard and the accompanying game state */
+func ParseBitboardFEN(fen string) (*AtaxxBitboard, AtaxxFENState, error) {
+	board, state, err := ParseBoardFEN(fen)
+	if err != nil {
+		return nil, state, err
+	}
+
+	bitboard := board.ToBitboard()
+	return &bitboard, state, nil
+}
+
+/* Format board and game state as FEN string */
+func (board *AtaxxBoard) FEN(state AtaxxFENState) string {
+	var fen strings.Builder
+
+	for y := 0; y < 7; y++ {
+		if y > 0 {
+			fen.WriteByte('/')
+		}
+
+		/* Count consecutive empty cells */
+		empty := 0
+		for x := 0; x < 7; x++ {
+			if board[y][x] == 0 {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				fen.WriteByte(byte('0' + empty))
+				empty = 0
+			}
+			if board[y][x] == BlockedCell {
+				fen.WriteByte('-')
+			} else if board[y][x] > 0 {
+				fen.WriteByte('x')
+			} else {
+				fen.WriteByte('o')
+			}
+		}
+		if empty > 0 {
+			fen.WriteByte(byte('0' + empty))
+		}
+	}
+
+	side := "o"
+	if state.MaximizingPlayer {
+		side = "x"
+	}
+	fmt.Fprintf(&fen, " %s %d %d", side, state.HalfmoveClock, state.FullmoveNumber)
+
+	return fen.String()
+}
+
+/* Format bitboard and game state as FEN string */
+func (board *AtaxxBitboard) FEN(state AtaxxFENState) string {
+	grid := board.ToBoard()
+	return grid.FEN(state)
+}
+
+/* Setup a game from a layout name or FEN string.
+ *
+ * An empty layout selects the standard starting position.
+ */
+func ParseLayout(layout string) (*AtaxxBoard, AtaxxFENState, error) {
+	if layout == "" {
+		layout = "standard"
+	}
+	if fen, found := StartingLayouts[layout]; found {
+		layout = fen
+	}
+
+	return ParseBoardFEN(layout)
+}
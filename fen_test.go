@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFENRoundTrip(t *testing.T) {
+	fens := []string{
+		"7/1xx1o2/1xoxoo1/2xxo2/1oxo3/2o4/7 x 0 10",
+		"xxxo1oo/xxoooox/xoxxxoo/ooxxoxx/xoooxxo/oxx1xo1/ooxoxoo o 37 40",
+		"7/7/7/7/7/7/7 o 0 1",
+	}
+	for _, fen := range StartingLayouts {
+		fens = append(fens, fen)
+	}
+
+	for _, fen := range fens {
+		board, state, err := ParseBoardFEN(fen)
+		if err != nil {
+			t.Errorf("%s: %v", fen, err)
+			continue
+		}
+		if formatted := board.FEN(state); formatted != fen {
+			t.Errorf("%s: formatted as %s", fen, formatted)
+		}
+
+		bitboard, bitState, err := ParseBitboardFEN(fen)
+		if err != nil || bitState != state {
+			t.Errorf("%s: bitboard state %+v, %v", fen, bitState, err)
+			continue
+		}
+		if formatted := bitboard.FEN(bitState); formatted != fen {
+			t.Errorf("%s: bitboard formatted as %s", fen, formatted)
+		}
+	}
+}
+
+func TestParseLayout(t *testing.T) {
+	for name, fen := range StartingLayouts {
+		board, state, err := ParseLayout(name)
+		if err != nil || board.FEN(state) != fen {
+			t.Errorf("%s: got %v, %v", name, board, err)
+		}
+	}
+
+	if board, state, err := ParseLayout(""); err != nil || board.FEN(state) != StartFEN {
+		t.Errorf("default layout: got %v, %v", board, err)
+	}
+	if _, _, err := ParseLayout("spiral"); err == nil {
+		t.Error("unknown layout accepted")
+	}
+}
+
+/* Optional fields take their defaults, upper case pieces and sides are
+ * accepted.
+ */
+func TestParseFENDefaults(t *testing.T) {
+	tests := []struct {
+		fen   string
+		state AtaxxFENState
+	}{
+		{"x5o/7/7/7/7/7/o5x x", AtaxxFENState{true, 0, 1}},
+		{"x5o/7/7/7/7/7/o5x O 12", AtaxxFENState{false, 12, 1}},
+		{"X5O/7/7/7/7/7/O5X x 3 20", AtaxxFENState{true, 3, 20}},
+	}
+
+	for _, test := range tests {
+		board, state, err := ParseBoardFEN(test.fen)
+		if err != nil || state != test.state {
+			t.Errorf("%s: state %+v, %v, expected %+v", test.fen, state, err, test.state)
+			continue
+		}
+		if board[0][0] != 1 || board[0][6] != -1 {
+			t.Errorf("%s: pieces not placed", test.fen)
+		}
+	}
+}
+
+func TestParseFENMalformed(t *testing.T) {
+	fens := []string{
+		"",
+		"x5o/7/7/7/7/7/o5x",
+		"x5o/7/7/7/7/7/o5x x 0 1 extra",
+
+		/* Rank count */
+		"x5o/7/7/7/7/o5x x 0 1",
+		"x5o/7/7/7/7/7/7/o5x x 0 1",
+		"x5o/7/7/7/7/7/o5x/ x 0 1",
+
+		/* Files per rank, digits */
+		"x6o/7/7/7/7/7/o5x x 0 1",
+		"x4o/7/7/7/7/7/o5x x 0 1",
+		"x5o/8/7/7/7/7/o5x x 0 1",
+		"x5o/07/7/7/7/7/o5x x 0 1",
+		"x5o/6/7/7/7/7/o5x x 0 1",
+		"x5o/7/7/3a3/7/7/o5x x 0 1",
+
+		/* Side to move */
+		"x5o/7/7/7/7/7/o5x - 0 1",
+		"x5o/7/7/7/7/7/o5x w 0 1",
+		"x5o/7/7/7/7/7/o5x xo 0 1",
+
+		/* Clocks */
+		"x5o/7/7/7/7/7/o5x x -1 1",
+		"x5o/7/7/7/7/7/o5x x a 1",
+		"x5o/7/7/7/7/7/o5x x 1.5 1",
+		"x5o/7/7/7/7/7/o5x x 0 0",
+		"x5o/7/7/7/7/7/o5x x 0 -3",
+		"x5o/7/7/7/7/7/o5x x 0 one",
+	}
+
+	for _, fen := range fens {
+		if _, _, err := ParseBoardFEN(fen); err == nil {
+			t.Errorf("%q accepted", fen)
+		}
+		if _, _, err := ParseBitboardFEN(fen); err == nil {
+			t.Errorf("%q accepted as bitboard", fen)
+		}
+	}
+}
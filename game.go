@@ -0,0 +1,192 @@
+/* Complete Ataxx games: move history, clocks and game results */
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+/* Outcome of a game */
+type GameResult int8
+
+const (
+	ResultNone GameResult = iota
+	ResultXWins
+	ResultOWins
+	ResultDraw
+)
+
+/* Number of plies without single moves or captures after which the game is
+ * drawn.
+ */
+const HalfmoveLimit = 100
+
+/* Number of occurrences of a position after which the game is drawn */
+const RepetitionLimit = 3
+
+/* Returned when playing a move in a finished game */
+var ErrGameOver = errors.New("game: game is over")
+
+/* A game in progress.
+ *
+ * Where the boards only know about the pieces, a game also tracks the move
+ * history, which is required for the draw rules:
+ *  - The halfmove clock counts plies since the last single move or capture,
+ *    the game is drawn when it reaches HalfmoveLimit.
+ *  - The position hashes of all earlier positions, the game is drawn when a
+ *    position occurs RepetitionLimit times.
+ */
+type AtaxxGame struct {
+	Board            AtaxxBitboard
+	MaximizingPlayer bool
+	HalfmoveClock    int
+	FullmoveNumber   int
+
+	/* Position the game started from, and moves played since */
+	StartFEN string
+	Moves    []AtaxxMove
+
+	/* Hashes of all positions, including the current one */
+	history []uint64
+}
+
+/* Result in the usual notation, "*" for games still in progress. X plays
+ * Black, as in UAI, so "0-1" is a win of X.
+ */
+func (result GameResult) String() string {
+	switch result {
+	case ResultXWins:
+		return "0-1"
+	case ResultOWins:
+		return "1-0"
+	case ResultDraw:
+		return "1/2-1/2"
+	}
+
+	return "*"
+}
+
+/* Results are written in the usual notation in JSON */
+func (result GameResult) MarshalText() ([]byte, error) {
+	return []byte(result.String()), nil
+}
+
+/* Parse a result in the usual notation */
+func (result *GameResult) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "0-1":
+		*result = ResultXWins
+	case "1-0":
+		*result = ResultOWins
+	case "1/2-1/2":
+		*result = ResultDraw
+	case "*", "":
+		*result = ResultNone
+	default:
+		return fmt.Errorf("result: invalid result %q", text)
+	}
+
+	return nil
+}
+
+/* Start a new game from the given FEN */
+func NewAtaxxGame(fen string) (*AtaxxGame, error) {
+	board, state, err := ParseBitboardFEN(fen)
+	if err != nil {
+		return nil, err
+	}
+
+	game := AtaxxGame{}
+	game.Board = *board
+	game.MaximizingPlayer = state.MaximizingPlayer
+	game.HalfmoveClock = state.HalfmoveClock
+	game.FullmoveNumber = state.FullmoveNumber
+	game.StartFEN = fen
+	game.Moves = make([]AtaxxMove, 0)
+	game.history = []uint64{board.Hash(state.MaximizingPlayer)}
+
+	return &game, nil
+}
+
+/* Play a move, returning an error if it is illegal or the game is over */
+func (game *AtaxxGame) Play(move AtaxxMove) error {
+	if game.Result() != ResultNone {
+		return fmt.Errorf("%w (%v)", ErrGameOver, game.Result())
+	}
+
+	if err := game.Board.CheckMove(move, game.MaximizingPlayer); err != nil {
+		return err
+	}
+
+	captured := game.Board.MakeMove(move, game.MaximizingPlayer)
+
+	/* Single moves and captures are irreversible, resetting the clock */
+	if move.IsSingle() || captured != 0 {
+		game.HalfmoveClock = 0
+	} else {
+		game.HalfmoveClock++
+	}
+	if !game.MaximizingPlayer {
+		game.FullmoveNumber++
+	}
+
+	game.MaximizingPlayer = !game.MaximizingPlayer
+	game.Moves = append(game.Moves, move)
+	game.history = append(game.history, game.Board.Hash(game.MaximizingPlayer))
+
+	return nil
+}
+
+/* Parse a move in algebraic notation and play it */
+func (game *AtaxxGame) PlayNotation(notation string) error {
+	move, err := ParseMove(notation)
+	if err != nil {
+		return err
+	}
+
+	return game.Play(move)
+}
+
+/* Number of times the current position occurred in this game */
+func (game *AtaxxGame) Repetitions() int {
+	current := game.history[len(game.history)-1]
+
+	count := 0
+	for _, hash := range game.history {
+		if hash == current {
+			count++
+		}
+	}
+
+	return count
+}
+
+/* Outcome of the game, ResultNone while still in progress */
+func (game *AtaxxGame) Result() GameResult {
+	result, _ := game.ResultReason()
+	return result
+}
+
+/* Outcome of the game along with a short description of why it ended */
+func (game *AtaxxGame) ResultReason() (GameResult, string) {
+	if result := game.Board.Result(); result != ResultNone {
+		if game.Board.maximizingPlayer == 0 || game.Board.minimizingPlayer == 0 {
+			return result, "elimination"
+		}
+		return result, "no moves left"
+	}
+
+	if game.HalfmoveClock >= HalfmoveLimit {
+		return ResultDraw, "halfmove clock"
+	}
+	if game.Repetitions() >= RepetitionLimit {
+		return ResultDraw, "threefold repetition"
+	}
+
+	return ResultNone, ""
+}
+
+/* The current position as FEN */
+func (game *AtaxxGame) FEN() string {
+	return game.Board.FEN(AtaxxFENState{game.MaximizingPlayer, game.HalfmoveClock, game.FullmoveNumber})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGameResultReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		fen    string
+		moves  []string
+		result GameResult
+		reason string
+	}{
+		{"in progress", StartFEN, []string{"b6", "f6"}, ResultNone, ""},
+		{"elimination", "xo5/7/7/7/7/7/7 x 0 1", []string{"a6"}, ResultXWins, "elimination"},
+		{"elimination of X", "x6/1o5/7/7/7/7/7 o 0 1", []string{"a6"}, ResultOWins, "elimination"},
+
+		/* O is walled in and passes until X filled the board */
+		{"blockade fill-in", "oxxxxxx/xxxxxxx/xxxxxxx/xxxxxxx/xxxxxxx/xxxxxxx/xxxxxx1 o 0 1", []string{"0000", "g1"}, ResultXWins, "no moves left"},
+
+		/* The empty cell in the middle cannot be reached by anyone */
+		{"blockade", "xxxxxxx/x-----x/x-----x/x--1--x/x-----x/x-----x/ooooooo x 0 1", nil, ResultXWins, "no moves left"},
+		{"blockade draw", "xxxxxxx/x-----x/x-----x/x--1--o/o-----o/o-----o/ooooooo o 0 1", nil, ResultDraw, "no moves left"},
+
+		{"halfmove clock", "x5o/7/7/7/7/7/o5x x 98 1", []string{"a7c7", "g7e7"}, ResultDraw, "halfmove clock"},
+		{"halfmove clock reset", "x5o/7/7/7/7/7/o5x x 99 1", []string{"b7"}, ResultNone, ""},
+		{"twofold repetition", StartFEN, []string{"a7c7", "g7e7", "c7a7", "e7g7"}, ResultNone, ""},
+		{"threefold repetition", StartFEN, []string{"a7c7", "g7e7", "c7a7", "e7g7", "a7c7", "g7e7", "c7a7", "e7g7"}, ResultDraw, "threefold repetition"},
+	}
+
+	for _, test := range tests {
+		game, err := NewAtaxxGame(test.fen)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for _, notation := range test.moves {
+			if err := game.PlayNotation(notation); err != nil {
+				t.Fatalf("%s: %s: %v", test.name, notation, err)
+			}
+		}
+
+		if result, reason := game.ResultReason(); result != test.result || reason != test.reason {
+			t.Errorf("%s: %v by %q, expected %v by %q", test.name, result, reason, test.result, test.reason)
+		}
+		if game.Result() != ResultNone {
+			if err := game.Play(PassMove); !errors.Is(err, ErrGameOver) {
+				t.Errorf("%s: played on after the end: %v", test.name, err)
+			}
+		}
+	}
+}
+
+/* Only single moves and captures reset the halfmove clock */
+func TestGameHalfmoveClock(t *testing.T) {
+	game, _ := NewAtaxxGame(StartFEN)
+	for _, step := range []struct {
+		notation string
+		clock    int
+	}{
+		{"a7c7", 1}, {"g7e7", 2}, {"b6", 0}, {"e7c5", 0}, {"c7e7", 1},
+	} {
+		if err := game.PlayNotation(step.notation); err != nil {
+			t.Fatalf("%s: %v", step.notation, err)
+		}
+		if game.HalfmoveClock != step.clock {
+			t.Errorf("%s: halfmove clock %d, expected %d", step.notation, game.HalfmoveClock, step.clock)
+		}
+	}
+
+	if game.FullmoveNumber != 3 {
+		t.Errorf("fullmove number %d, expected 3", game.FullmoveNumber)
+	}
+}
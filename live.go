@@ -0,0 +1,284 @@
+/* Live game events over WebSocket */
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+/* Clients connecting to /games/{id}/ws receive the events of that game as
+ * JSON text messages, distinguished by their "type":
+ *
+ *  state     -> the full game, sent once after connecting
+ *  info      -> progress of the computer's search: depth, score, pv, ...
+ *  move      -> a move was played, along with the resulting game
+ *  gameover  -> the game ended, with result and reason
+ *  error     -> a command sent over this connection failed
+ *
+ * Scores are from X's point of view, as everywhere else in the server.
+ *
+ * Besides watching, clients can play over the same connection by sending
+ * commands:
+ *
+ *  {"type": "move", "move": "a1c3"}    -> play a move
+ *  {"type": "ply", "move_time": 1000}  -> let the computer move, "level"
+ *                                         optionally overrides the game's
+ *
+ * Any number of clients may watch a game, which allows for spectators.
+ */
+
+/* Sent after connecting */
+type GameStateEvent struct {
+	Type string   `json:"type"`
+	Game GameView `json:"game"`
+}
+
+/* Search progress, sent after every completed iteration, see SearchInfo */
+type GameInfoEvent struct {
+	Type     string   `json:"type"`
+	Depth    int      `json:"depth"`
+	SelDepth int      `json:"seldepth"`
+	Score    int      `json:"score"`
+	Nodes    int      `json:"nodes"`
+	NPS      int      `json:"nps"`
+	Time     int64    `json:"time"`
+	HashHits float64  `json:"hashhits"`
+	PV       []string `json:"pv"`
+}
+
+/* Sent whenever a move is played, by anyone */
+type GameMoveEvent struct {
+	Type string   `json:"type"`
+	Move string   `json:"move"`
+	Game GameView `json:"game"`
+}
+
+/* Sent once the game has ended */
+type GameOverEvent struct {
+	Type   string     `json:"type"`
+	Result GameResult `json:"result"`
+	Reason string     `json:"reason"`
+}
+
+/* Sent to a single client when its command failed, see APIError */
+type GameErrorEvent struct {
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+/* Command received from a client */
+type GameCommand struct {
+	Type     string `json:"type"`
+	Move     string `json:"move"`
+	MoveTime int    `json:"move_time"`
+	Level    string `json:"level"`
+}
+
+/* Number of events queued for a client before it is considered to have
+ * fallen behind.
+ */
+const watcherQueueSize = 64
+
+/* Send an event to all clients watching the game.
+ *
+ * Events are queued for every client and written by its own goroutine, see
+ * writeEvents, so a slow client does not hold up the game or the others.
+ * Clients that fall behind by more than watcherQueueSize events are
+ * disconnected.
+ */
+func (session *gameSession) broadcast(event interface{}) {
+	message, err := json.Marshal(event)
+	if err != nil {
+		log.Println("/games: cannot encode event:", err)
+		return
+	}
+
+	session.watchMutex.Lock()
+	defer session.watchMutex.Unlock()
+
+	for ws, queue := range session.watchers {
+		select {
+		case queue <- message:
+		default:
+			delete(session.watchers, ws)
+			close(queue)
+		}
+	}
+}
+
+/* Send an event to a single client watching the game, if it still is */
+func (session *gameSession) send(ws *WebSocket, event interface{}) {
+	message, err := json.Marshal(event)
+	if err != nil {
+		log.Println("/games: cannot encode event:", err)
+		return
+	}
+
+	session.watchMutex.Lock()
+	defer session.watchMutex.Unlock()
+
+	if queue, found := session.watchers[ws]; found {
+		select {
+		case queue <- message:
+		default:
+			delete(session.watchers, ws)
+			close(queue)
+		}
+	}
+}
+
+/* Start sending events to a client, first is sent before any other event */
+func (session *gameSession) watch(ws *WebSocket, first []byte) {
+	queue := make(chan []byte, watcherQueueSize)
+	queue <- first
+
+	session.watchMutex.Lock()
+	session.watchers[ws] = queue
+	session.watchMutex.Unlock()
+
+	go session.writeEvents(ws, queue)
+}
+
+/* Stop sending events to a client. The connection is closed once the events
+ * already queued have been written.
+ */
+func (session *gameSession) unwatch(ws *WebSocket) {
+	session.watchMutex.Lock()
+	defer session.watchMutex.Unlock()
+
+	if queue, found := session.watchers[ws]; found {
+		delete(session.watchers, ws)
+		close(queue)
+	}
+}
+
+/* Write the events queued for a client until it stops watching or the
+ * connection fails, then close the connection.
+ */
+func (session *gameSession) writeEvents(ws *WebSocket, queue <-chan []byte) {
+	for message := range queue {
+		if err := ws.WriteText(message); err != nil {
+			session.unwatch(ws)
+			break
+		}
+	}
+
+	ws.Close()
+}
+
+/* Close the connections of all clients watching the game */
+func (session *gameSession) disconnectWatchers() {
+	session.watchMutex.Lock()
+	defer session.watchMutex.Unlock()
+
+	for ws, queue := range session.watchers {
+		delete(session.watchers, ws)
+		close(queue)
+	}
+}
+
+/* Announce a move, and the end of the game if it ended by it */
+func (session *gameSession) broadcastMove(move string, view GameView) {
+	session.broadcast(&GameMoveEvent{"move", move, view})
+	if view.Result != ResultNone {
+		session.broadcast(&GameOverEvent{"gameover", view.Result, view.Reason})
+	}
+}
+
+/* Announce search progress */
+func (session *gameSession) broadcastInfo(info SearchInfo) {
+	event := GameInfoEvent{"info", info.Depth, info.SelDepth, info.Score, info.Nodes, info.NPS,
+		info.Time.Milliseconds(), info.HashHits, make([]string, len(info.PV))}
+	for i, move := range info.PV {
+		event.PV[i] = move.String()
+	}
+
+	session.broadcast(&event)
+}
+
+/* GET /games/{id}/ws */
+func (session *gameSession) handleWatch(w http.ResponseWriter, r *http.Request) {
+	ws, err := UpgradeWebSocket(w, r)
+	if err != nil {
+		log.Println("/games:", err)
+		return
+	}
+
+	/* Searches started by this client are abandoned once it leaves */
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	/* Send the current state before any other events */
+	session.mutex.Lock()
+	state, err := json.Marshal(&GameStateEvent{"state", session.view()})
+	if err == nil {
+		session.watch(ws, state)
+	}
+	session.mutex.Unlock()
+	if err != nil {
+		log.Println("/games: cannot encode event:", err)
+		ws.Close()
+		return
+	}
+
+	for {
+		var message []byte
+		_, message, err = ws.ReadMessage()
+		if err != nil {
+			break
+		}
+
+		var command GameCommand
+		if decodeErr := json.Unmarshal(message, &command); decodeErr != nil {
+			session.sendError(ws, NewAPIError(http.StatusBadRequest, "invalid_json", fmt.Errorf("json: %v", decodeErr)))
+			continue
+		}
+		session.runCommand(ctx, ws, command)
+	}
+
+	session.unwatch(ws)
+
+	if err != io.EOF {
+		log.Println("/games: websocket:", err)
+	}
+}
+
+/* Execute a command received over WebSocket.
+ *
+ * Results reach the client through the broadcast events, only errors are
+ * sent directly.
+ */
+func (session *gameSession) runCommand(ctx context.Context, ws *WebSocket, command GameCommand) {
+	switch command.Type {
+	case "move":
+		if _, err := session.PlayMove(command.Move); err != nil {
+			session.sendError(ws, err)
+		}
+
+	case "ply":
+		/* Keep reading while the computer is thinking, so we notice the
+		 * client leaving.
+		 */
+		request := AtaxxPlyRequest{MoveTime: command.MoveTime, Level: command.Level}
+		go func() {
+			_, err := session.ComputerMove(ctx, request.Level, request.thinkTime())
+			if err != nil && ctx.Err() == nil {
+				session.sendError(ws, err)
+			}
+		}()
+
+	default:
+		session.sendError(ws, NewAPIError(http.StatusBadRequest, "unknown_command", fmt.Errorf("unknown command %q", command.Type)))
+	}
+}
+
+/* Tell a single client its command failed */
+func (session *gameSession) sendError(ws *WebSocket, err error) {
+	apiErr := toAPIError(err)
+	session.send(ws, &GameErrorEvent{"error", apiErr.Code, apiErr.Message})
+}
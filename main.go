@@ -1,156 +1,289 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
 	"html"
-	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	if true {
-		/* Setup pre-calculated bitboard tables */
-		InitBitboards()
-
-		/* Setup routes */
-		http.Handle("/", http.FileServer(http.Dir(".")))
-
-		http.HandleFunc("/bar", func(w http.ResponseWriter, r *http.Request) {
-			fmt.Fprintf(w, "Hello, %q", html.EscapeString(r.URL.Path))
-		})
-
-		http.HandleFunc("/ply", func(w http.ResponseWriter, r *http.Request) {
-			if r.Method != http.MethodPost {
-				fmt.Println("Received method", r.Method)
-				w.WriteHeader(http.StatusMethodNotAllowed)
-				return
-			}
-			var lr io.LimitedReader
-			/* Allow a post-body of maximum size 1kB
-			 * This should be more than enough for the JSON POST requests we handle.
-			 */
-			lr.R = r.Body
-			lr.N = 1024
-			decoder := json.NewDecoder(&lr)
-
-			/* Decode board state + player on turn */
-			var ply AtaxxPly
-			err := decoder.Decode(&ply)
-			if err != nil {
-				panic(err)
-			}
+	/* Setup pre-calculated bitboard tables */
+	InitBitboards()
 
-			/* Convert to bitboard for higher performance */
-			bitboard := ply.Board.ToBitboard()
+	/* Select mode of operation, serving the web interface by default */
+	command := "serve"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
 
-			/* Compute next computer move */
-			newBoard, _ := AlphaBeta(&bitboard, ply.MaximizingPlayer, 4, -49, 49)
+	/* Options of the commands playing moves, selfplay has its own */
+	switch command {
+	case "serve", "uai":
+		if err := parseEngineFlags(flag.NewFlagSet(command, flag.ContinueOnError), os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
 
-			/* Return resulting game state */
-			var rply AtaxxPly
-			rply.Board = newBoard.(*AtaxxBitboard).ToBoard()
-			rply.MaximizingPlayer = !ply.MaximizingPlayer
+	switch command {
+	case "serve":
+		Serve()
 
-			/* Marshal to JSON */
-			w.Header().Set("Content-Type", "application/json")
-			encoder := json.NewEncoder(w)
-			err = encoder.Encode(&rply)
-			if err != nil {
-				panic(err)
-			}
-		})
-
-		/* Handle a player-made move */
-		http.HandleFunc("/move", func(w http.ResponseWriter, r *http.Request) {
-			if r.Method != http.MethodPost {
-				fmt.Println("Received method", r.Method)
-				w.WriteHeader(http.StatusMethodNotAllowed)
-				return
-			}
-			var lr io.LimitedReader
-			/* Allow a post-body of maximum size 1kB
-			 * This should be more than enough for the JSON POST requests we handle.
-			 */
-			lr.R = r.Body
-			lr.N = 1024
-			decoder := json.NewDecoder(&lr)
-
-			/* Decode board state + player on turn */
-			var move AtaxxPlayerMove
-			err := decoder.Decode(&move)
-			if err != nil {
-				panic(err)
-			}
+	case "uai":
+		RunUAI(os.Stdin, os.Stdout)
 
-			/* Compute coordinates */
-			srcX := move.Source % 7
-			srcY := move.Source / 7
-			tgtX := move.Target % 7
-			tgtY := move.Target / 7
-
-			/* Perform human move */
-			newBoard, valid := HumanMove(&move.State.Board, move.State.MaximizingPlayer, srcX, srcY, tgtX, tgtY)
-
-			/* Return resulting game state */
-			var rply AtaxxPly
-			rply.Board = newBoard
-			/* No longer our turn */
-			if valid {
-				rply.MaximizingPlayer = !move.State.MaximizingPlayer
-				/* Still our turn */
-			} else {
-				rply.MaximizingPlayer = move.State.MaximizingPlayer
-			}
+	case "selfplay":
+		flags := flag.NewFlagSet(command, flag.ContinueOnError)
+		pgnFile := flags.String("pgn", "", "append the game to this file")
+		if err := parseEngineFlags(flags, os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		SelfPlay(*pgnFile)
 
-			/* Marshal to JSON */
-			w.Header().Set("Content-Type", "application/json")
-			encoder := json.NewEncoder(w)
-			err = encoder.Encode(&rply)
-			if err != nil {
-				panic(err)
-			}
-		})
-
-		/* Return a new Game board in JSON AtaxxPly format over GET request */
-		http.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
-			if r.Method != http.MethodGet {
-				fmt.Println("Received method", r.Method)
-				w.WriteHeader(http.StatusMethodNotAllowed)
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			encoder := json.NewEncoder(w)
-			var newGame AtaxxPly
-			newGame = AtaxxPly{*NewGame(), true}
-			//board := NewGame()
-			//fmt.Println(newGame)
-			jsonPly, err := json.Marshal(newGame)
-			if err != nil {
-				panic(err)
-			}
-			fmt.Println(jsonPly)
-			err = encoder.Encode(&newGame)
-			if err != nil {
-				panic(err)
-			}
-		})
+	case "perft":
+		if err := RunPerft(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+	case "match":
+		if err := RunMatch(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+	case "book":
+		if err := RunBook(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
 
-		log.Fatal(http.ListenAndServe(":8080", nil))
+	case "bench":
+		if err := RunBench(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+	case "tune":
+		if err := RunTune(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, "Unknown command", command)
+		fmt.Fprintln(os.Stderr, "Usage:", os.Args[0], "[serve|uai|selfplay|perft|bench|match|tune|book]")
+		os.Exit(2)
 	}
+}
 
-	/* Setup pre-calculated bitboard tables */
-	InitBitboards()
+/* Parse the options shared by all commands playing moves, along with those
+ * already defined in flags
+ *
+ * -eval FILE   load evaluation weights, see LoadEvalWeights
+ * -book FILE   play from an opening book, see OpeningBook
+ */
+func parseEngineFlags(flags *flag.FlagSet, args []string) error {
+	evalFile := flags.String("eval", "", "evaluation weights file")
+	bookFile := flags.String("book", "", "opening book file")
+	threads := flags.Int("threads", 1, "number of threads per search")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *threads < 1 {
+		return fmt.Errorf("invalid number of threads %d", *threads)
+	}
+	SetSearchThreads(*threads)
+
+	if *evalFile != "" {
+		weights, err := LoadEvalWeights(*evalFile)
+		if err != nil {
+			return err
+		}
+		SetEvalWeights(weights)
+	}
+	if *bookFile != "" {
+		book, err := LoadOpeningBook(*bookFile)
+		if err != nil {
+			return err
+		}
+		SetOpeningBook(book)
+	}
 
+	return nil
+}
+
+/* Serve the web interface and its JSON API on port 8080 */
+func Serve() {
+	/* Setup routes */
+	http.Handle("/", http.FileServer(http.Dir(".")))
+
+	http.HandleFunc("/bar", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Hello, %q", html.EscapeString(r.URL.Path))
+	})
+
+	http.HandleFunc("/ply", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, errMethodNotAllowed)
+			return
+		}
+
+		/* Decode board state + player on turn */
+		var ply AtaxxPlyRequest
+		if err := decodeJSON(r, &ply); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		/* Convert to bitboard for higher performance */
+		bitboard := ply.Board.ToBitboard()
+		if result := bitboard.Result(); result != ResultNone {
+			writeError(w, fmt.Errorf("%w (%v)", ErrGameOver, result))
+			return
+		}
+
+		level, err := ParseDifficulty(ply.Level)
+		if err != nil {
+			writeError(w, NewAPIError(http.StatusBadRequest, "invalid_level", err))
+			return
+		}
+
+		/* Compute next computer move at the requested level */
+		searcher := NewSearcher(NewBitTranspositionTable(160000))
+		result := level.ChooseMove(r.Context(), searcher, &bitboard, ply.MaximizingPlayer, ply.thinkTime())
+
+		/* Client went away or server is shutting down */
+		if result.Incomplete {
+			log.Println("/ply: search aborted:", r.Context().Err())
+			writeError(w, errSearchAborted)
+			return
+		}
+		log.Println("/ply:", level.Name, result.Info)
+		bitboard.MakeMove(result.Move, ply.MaximizingPlayer)
+
+		/* Return resulting game state, along with the move played */
+		var rply AtaxxPlyResult
+		rply.Board = bitboard.ToBoard()
+		rply.MaximizingPlayer = !ply.MaximizingPlayer
+		rply.Move = result.Move.String()
+		rply.Score = result.Score
+		rply.Result = bitboard.Result()
+
+		writeJSON(w, http.StatusOK, &rply)
+	})
+
+	/* Handle a player-made move */
+	http.HandleFunc("/move", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, errMethodNotAllowed)
+			return
+		}
+
+		/* Decode board state + player on turn */
+		var move AtaxxPlayerMove
+		if err := decodeJSON(r, &move); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		/* Compute coordinates */
+		srcX := move.Source % 7
+		srcY := move.Source / 7
+		tgtX := move.Target % 7
+		tgtY := move.Target / 7
+
+		/* Perform human move, telling the player why it was rejected */
+		newBoard, err := HumanMove(&move.State.Board, move.State.MaximizingPlayer, srcX, srcY, tgtX, tgtY)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		/* Return resulting game state, no longer our turn */
+		var rply AtaxxPly
+		rply.Board = newBoard
+		rply.MaximizingPlayer = !move.State.MaximizingPlayer
+		resultBoard := newBoard.ToBitboard()
+		rply.Result = resultBoard.Result()
+
+		writeJSON(w, http.StatusOK, &rply)
+	})
+
+	/* Server side game sessions, see sessions.go */
+	games := NewGameStore()
+	http.Handle("/games", games)
+	http.Handle("/games/", games)
+
+	/* Return a new Game board in JSON AtaxxPly format over GET request
+	 *
+	 * The starting layout is selected by name (?layout=gaps) or FEN (?fen=...)
+	 */
+	http.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, errMethodNotAllowed)
+			return
+		}
+
+		/* Start from a named layout or FEN if requested */
+		layout := r.URL.Query().Get("layout")
+		if fen := r.URL.Query().Get("fen"); fen != "" {
+			layout = fen
+		}
+		board, state, err := ParseLayout(layout)
+		if err != nil {
+			writeError(w, NewAPIError(http.StatusBadRequest, "invalid_layout", err))
+			return
+		}
+
+		newGame := AtaxxPly{Board: *board, MaximizingPlayer: state.MaximizingPlayer}
+		writeJSON(w, http.StatusOK, &newGame)
+	})
+
+	/* All request contexts derive from a base context that is cancelled on
+	 * shutdown, so running searches are aborted instead of delaying exit.
+	 */
+	baseContext, cancel := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:        ":8080",
+		Handler:     logRequests(http.DefaultServeMux),
+		BaseContext: func(net.Listener) context.Context { return baseContext },
+	}
+
+	/* Shutdown gracefully on interrupt */
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		log.Println("Shutting down")
+		cancel()
+		server.Shutdown(context.Background())
+	}()
+
+	err := server.ListenAndServe()
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+/* Let the engine play a game against itself, printing every board and
+ * finally the game record, which is also appended to pgnFile if given.
+ */
+func SelfPlay(pgnFile string) {
 	/* Initialize a new game board */
-	//board := NewGame()
-	board := NewBitGame()
+	game, _ := NewAtaxxGame(StartFEN)
 	fmt.Println("Start of game")
-	board.Print()
-
-	turn := 1
-	color := 1
+	game.Board.Print()
 
 	//for i, newBoard := range board.NextBoards(true) {
 	//	fmt.Println("Next position", i)
@@ -159,30 +292,83 @@ func main() {
 	//return
 
 	/* Self play until finished. */
-	//transposition := NewTranspositionTable(160000)
 	transposition := NewBitTranspositionTable(160000)
-	for !board.Finished() {
+	comments := make([]string, 0)
+	for game.Result() == ResultNone {
 		var currentPlayer string
-		if color == 1 {
+		if game.MaximizingPlayer {
 			currentPlayer = "X"
 		} else {
 			currentPlayer = "O"
 		}
 
-		fmt.Println("Turn", turn, currentPlayer, "moves")
-		//newBoard, _ := Minimax(board, color, 3)
-		//newBoard, _ := AlphaBeta(board, color == 1, 5, -49, 49)
-		//newBoard, _ := AlphaBetaTransposition(board, color == 1, 4, -49, 49, NewTranspositionTable(60000))
-		//newBoard, _ := AlphaBetaTransposition(board, color == 1, 5, -49, 49, transposition)
-		newBoard, _ := AlphaBetaTransposition(board, color == 1, 3, -49, 49, transposition)
+		fmt.Println("Turn", game.FullmoveNumber, currentPlayer, "moves")
+		//move, _ := AlphaBeta(&game.Board, game.MaximizingPlayer, 5, -ScoreInfinity, ScoreInfinity)
+		//move, _ := AlphaBetaTransposition(&game.Board, game.MaximizingPlayer, 5, -ScoreInfinity, ScoreInfinity, transposition)
+		if engineBook != nil {
+			if move, found := engineBook.Probe(&game.Board, game.MaximizingPlayer); found {
+				game.Play(move)
+				comments = append(comments, "book")
+				fmt.Println(currentPlayer, "plays", move, "(book)")
+				game.Board.Print()
+				continue
+			}
+		}
+		result := AlphaBetaContext(context.Background(), &game.Board, game.MaximizingPlayer, 3, -ScoreInfinity, ScoreInfinity, transposition)
+		move := result.Move
+
+		game.Play(move)
+		comments = append(comments, SearchComment(result))
+		fmt.Println(currentPlayer, "plays", move, "("+result.Info.String()+")")
+		game.Board.Print()
+	}
+
+	result, reason := game.ResultReason()
+	fmt.Println("Result", result, "by", reason)
 
-		//board = newBoard.(*AtaxxBoard)
-		board = newBoard.(*AtaxxBitboard)
-		board.Print()
-		color = -color
-		turn += 1
+	stats := transposition.Stats()
+	fmt.Printf("Hash table: %d probes, %.1f%% hits, %d stores, %d‰ full\n",
+		stats.Probes, 100*stats.HitRate(), stats.Stores, transposition.Fill())
+
+	record := NewGameRecord(game)
+	record.SetTag("Event", "Self-play")
+	record.SetTag("White", uaiEngineName)
+	record.SetTag("Black", uaiEngineName)
+	record.SetTag("Termination", reason)
+	for i, comment := range comments {
+		record.Moves[i].Comment = comment
+	}
+	fmt.Println()
+	record.Write(os.Stdout)
+
+	if pgnFile != "" {
+		file, err := os.OpenFile(pgnFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err == nil {
+			err = record.Write(file)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
+
+/* Default and maximum thinking time for computer moves over HTTP */
+const defaultMoveTime = time.Second
+const maxMoveTime = 10 * time.Second
+
+/* Thinking time requested by the client, clamped to sane values */
+func (ply *AtaxxPlyRequest) thinkTime() time.Duration {
+	moveTime := time.Duration(ply.MoveTime) * time.Millisecond
+	if moveTime <= 0 {
+		return defaultMoveTime
+	}
+	if moveTime > maxMoveTime {
+		return maxMoveTime
 	}
-	fmt.Println("Hash tables items:", len(transposition.transpositionMap))
 
-	return
+	return moveTime
 }
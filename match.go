@@ -0,0 +1,524 @@
+/* Engine versus engine matches */
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* A match plays pairs of games between two engines from the same opening,
+ * each engine playing X once, so neither benefits from a lucky opening or
+ * colour. Games run concurrently, every worker running its own engine
+ * instances.
+ *
+ * Results are reported from the point of view of the first engine: wins,
+ * draws and losses, and the Elo difference with its 95% confidence
+ * interval. Optionally the match stops early once a sequential probability
+ * ratio test (SPRT) decides between two hypotheses, e.g. "the change gains
+ * nothing" (elo0 = 0) and "the change gains 5 Elo" (elo1 = 5), with error
+ * rates alpha and beta.
+ */
+
+/* Outcome of a single match game */
+type MatchGame struct {
+	Number  int
+	Opening string
+	X, O    int /* Engine index, 0 for the first engine */
+	Moves   []AtaxxMove
+	Result  GameResult
+	Reason  string
+}
+
+/* Wins, draws and losses of the first engine */
+type MatchScore struct {
+	Wins, Draws, Losses int
+}
+
+/* Settings of a match */
+type Match struct {
+	Engines     [2]EngineConfig
+	Openings    []string
+	Games       int
+	Concurrency int
+
+	/* Openings are varied by up to BookPlies moves from Book, or if not in
+	 * the book by RandomPlies random moves.
+	 */
+	Book        *OpeningBook
+	BookPlies   int
+	RandomPlies int
+
+	/* Games are written here when set, see GameRecord */
+	Record io.Writer
+
+	/* SPRT bounds in Elo and error rates, disabled when both bounds are 0 */
+	Elo0, Elo1  float64
+	Alpha, Beta float64
+}
+
+/* Play the match, reporting every game to out. Returns the final score,
+ * along with an error if no opening could be found for the next pair of
+ * games, in which case the match ends early.
+ */
+func (match *Match) Run(out io.Writer) (MatchScore, error) {
+	var mutex sync.Mutex
+	var score MatchScore
+	stop := false
+
+	jobs := make(chan MatchGame)
+	var workers sync.WaitGroup
+	for i := 0; i < match.Concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+
+			/* Engines are kept running between games, by engine index */
+			var players [2]MatchPlayer
+			defer func() {
+				for _, player := range players {
+					if player != nil {
+						player.Close()
+					}
+				}
+			}()
+
+			for game := range jobs {
+				match.play(&game, &players)
+
+				mutex.Lock()
+				score.Add(&game)
+				if match.Record != nil {
+					match.record(&game).Write(match.Record)
+				}
+				fmt.Fprintf(out, "Game %d (%s vs %s): %v by %s\n", game.Number,
+					match.Engines[game.X].Name, match.Engines[game.O].Name, game.Result, game.Reason)
+				fmt.Fprintf(out, "Score of %s vs %s: %v\n", match.Engines[0].Name, match.Engines[1].Name, &score)
+				if match.sprt() {
+					llr, lower, upper := score.LLR(match.Elo0, match.Elo1, match.Alpha, match.Beta)
+					fmt.Fprintf(out, "LLR %.2f (%.2f, %.2f)\n", llr, lower, upper)
+					if llr <= lower || llr >= upper {
+						stop = true
+					}
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	/* Hand out pairs of games until done or the SPRT decided */
+	var opening string
+	var err error
+	for number := 1; number <= match.Games; number++ {
+		mutex.Lock()
+		stopped := stop
+		mutex.Unlock()
+		if stopped {
+			break
+		}
+
+		first := (number - 1) % 2
+		if first == 0 {
+			if opening, err = match.opening((number - 1) / 2); err != nil {
+				break
+			}
+		}
+		jobs <- MatchGame{Number: number, Opening: opening, X: first, O: 1 - first}
+	}
+	close(jobs)
+	workers.Wait()
+
+	return score, err
+}
+
+/* Whether the SPRT is enabled */
+func (match *Match) sprt() bool {
+	return match.Elo0 != 0 || match.Elo1 != 0
+}
+
+/* Play a single game with the given players, filling in its moves and
+ * result.
+ *
+ * A player losing on time, playing an illegal move or failing otherwise
+ * loses the game. Failing players are closed, to be restarted for the
+ * next game.
+ */
+func (match *Match) play(record *MatchGame, players *[2]MatchPlayer) {
+	game, err := NewAtaxxGame(record.Opening)
+	if err != nil {
+		record.Result, record.Reason = ResultDraw, err.Error()
+		return
+	}
+
+	/* Engines and clocks indexed by side, O first as in uaiLimits */
+	engines := [2]int{record.O, record.X}
+	var clocks, increments [2]time.Duration
+	for side, engine := range engines {
+		config := &match.Engines[engine]
+		clocks[side], increments[side] = config.Time, config.Increment
+	}
+
+	fail := func(side int, reason string) {
+		record.Result, record.Reason = forfeit(side), reason
+		if player := players[engines[side]]; player != nil {
+			player.Close()
+			players[engines[side]] = nil
+		}
+	}
+
+	for side, engine := range engines {
+		var err error
+		if players[engine] == nil {
+			players[engine], err = match.Engines[engine].Start()
+		}
+		if err == nil {
+			err = players[engine].NewGame()
+		}
+		if err != nil {
+			fail(side, err.Error())
+			return
+		}
+	}
+
+	for game.Result() == ResultNone {
+		side := boolIndex(game.MaximizingPlayer)
+		config := &match.Engines[engines[side]]
+
+		move, elapsed, err := players[engines[side]].Move(game, config.limits(clocks, increments))
+		if err != nil {
+			fail(side, err.Error())
+			break
+		}
+
+		if config.Time > 0 {
+			clocks[side] -= elapsed
+			if clocks[side] < 0 {
+				record.Result, record.Reason = forfeit(side), "time forfeit"
+				break
+			}
+			clocks[side] += config.Increment
+		}
+
+		if err := game.Play(move); err != nil {
+			record.Result, record.Reason = forfeit(side), fmt.Sprintf("%v: %v", move, err)
+			break
+		}
+	}
+
+	record.Moves = game.Moves
+	if record.Result == ResultNone {
+		record.Result, record.Reason = game.ResultReason()
+	}
+}
+
+/* Game record of a match game */
+func (match *Match) record(game *MatchGame) *GameRecord {
+	record := newGameRecord(game.Opening, game.Moves, game.Result)
+	record.SetTag("Event", fmt.Sprintf("%s vs %s", match.Engines[0].Name, match.Engines[1].Name))
+	record.SetTag("Round", strconv.Itoa(game.Number))
+	record.SetTag("White", match.Engines[game.O].Name)
+	record.SetTag("Black", match.Engines[game.X].Name)
+	record.SetTag("Termination", game.Reason)
+
+	return record
+}
+
+/* Result of the given side losing by forfeit */
+func forfeit(side int) GameResult {
+	if side == 1 {
+		return ResultOWins
+	}
+	return ResultXWins
+}
+
+/* Count a game for the first engine */
+func (score *MatchScore) Add(game *MatchGame) {
+	switch {
+	case game.Result == ResultDraw:
+		score.Draws++
+	case (game.Result == ResultXWins) == (game.X == 0):
+		score.Wins++
+	default:
+		score.Losses++
+	}
+}
+
+func (score *MatchScore) Games() int {
+	return score.Wins + score.Draws + score.Losses
+}
+
+/* Average score per game, a win counting 1 and a draw 0.5.
+ *
+ * Without any games the score is taken to be even.
+ */
+func (score *MatchScore) Ratio() float64 {
+	if score.Games() == 0 {
+		return 0.5
+	}
+
+	return (float64(score.Wins) + float64(score.Draws)/2) / float64(score.Games())
+}
+
+/* Variance of the score of a single game */
+func (score *MatchScore) variance() float64 {
+	ratio, games := score.Ratio(), float64(score.Games())
+	return (float64(score.Wins)*(1-ratio)*(1-ratio) +
+		float64(score.Draws)*(0.5-ratio)*(0.5-ratio) +
+		float64(score.Losses)*ratio*ratio) / games
+}
+
+/* Elo difference corresponding to an average score */
+func eloDifference(ratio float64) float64 {
+	return -400 * math.Log10(1/ratio-1)
+}
+
+/* Expected average score for an Elo difference */
+func expectedScore(elo float64) float64 {
+	return 1 / (1 + math.Pow(10, -elo/400))
+}
+
+/* Elo difference of the first engine along with the margin of its 95%
+ * confidence interval. Both are infinite when one side scored everything,
+ * the margin alone is infinite when no games were played.
+ */
+func (score *MatchScore) Elo() (elo float64, margin float64) {
+	ratio := score.Ratio()
+	if score.Games() == 0 {
+		return 0, math.Inf(1)
+	}
+	if ratio == 0 || ratio == 1 {
+		return eloDifference(ratio), math.Inf(1)
+	}
+	deviation := math.Sqrt(score.variance() / float64(score.Games()))
+	low := eloDifference(math.Max(ratio-1.96*deviation, 0))
+	high := eloDifference(math.Min(ratio+1.96*deviation, 1))
+
+	return eloDifference(ratio), (high - low) / 2
+}
+
+/* Log-likelihood ratio of elo1 over elo0, along with the bounds at which
+ * the test accepts elo0 (lower) or elo1 (upper).
+ *
+ * Uses the normal approximation of the average score, which is accurate
+ * enough once a few dozen games have been played. Half a game is added to
+ * every count, so a one-sided start does not make the variance vanish.
+ */
+func (score *MatchScore) LLR(elo0, elo1, alpha, beta float64) (llr, lower, upper float64) {
+	lower, upper = math.Log(beta/(1-alpha)), math.Log((1-beta)/alpha)
+
+	wins, draws, losses := float64(score.Wins)+0.5, float64(score.Draws)+0.5, float64(score.Losses)+0.5
+	games := wins + draws + losses
+	ratio := (wins + draws/2) / games
+	variance := (wins*(1-ratio)*(1-ratio) + draws*(0.5-ratio)*(0.5-ratio) + losses*ratio*ratio) / games
+
+	score0, score1 := expectedScore(elo0), expectedScore(elo1)
+	llr = games * (score1 - score0) * (2*ratio - score0 - score1) / (2 * variance)
+
+	return llr, lower, upper
+}
+
+func (score *MatchScore) String() string {
+	return fmt.Sprintf("%d - %d - %d [%.3f] %d", score.Wins, score.Losses, score.Draws, score.Ratio(), score.Games())
+}
+
+/* Read openings, one layout name or FEN per line.
+ *
+ * Empty lines and lines starting with '#' are skipped.
+ * Positions in which the game is already decided are rejected.
+ */
+func ReadOpenings(in io.Reader) ([]string, error) {
+	openings := make([]string, 0)
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		board, state, err := ParseLayout(text)
+		if err != nil {
+			return openings, err
+		}
+		fen := board.FEN(state)
+		if finishedFEN(fen) {
+			return openings, fmt.Errorf("match: opening %q is already finished", text)
+		}
+		openings = append(openings, fen)
+	}
+
+	return openings, scanner.Err()
+}
+
+/* Number of tries at random moves not deciding the game, see opening */
+const openingAttempts = 100
+
+/* Opening of a pair of games: one of the openings, varied by playing
+ * moves from the book, or random moves for openings not in the book.
+ * Random moves avoid positions in which the game is already decided,
+ * giving up after openingAttempts tries.
+ */
+func (match *Match) opening(pair int) (string, error) {
+	opening := match.Openings[pair%len(match.Openings)]
+	if match.Book != nil {
+		fen, played, err := match.Book.Walk(opening, match.BookPlies)
+		if err == nil && played > 0 && !finishedFEN(fen) {
+			return fen, nil
+		}
+	}
+
+	for attempt := 0; attempt < openingAttempts; attempt++ {
+		game, err := NewAtaxxGame(opening)
+		if err != nil {
+			return opening, err
+		}
+		for ply := 0; ply < match.RandomPlies && game.Result() == ResultNone; ply++ {
+			moves := game.Board.Moves(game.MaximizingPlayer)
+			game.Play(moves[rand.Intn(len(moves))])
+		}
+		if game.Result() == ResultNone {
+			return game.FEN(), nil
+		}
+	}
+
+	return opening, fmt.Errorf("match: no undecided position within %d random plies of %s", match.RandomPlies, opening)
+}
+
+/* Whether the game is already decided in a position, or the FEN invalid */
+func finishedFEN(fen string) bool {
+	game, err := NewAtaxxGame(fen)
+	return err != nil || game.Result() != ResultNone
+}
+
+/* Run the match subcommand
+ *
+ * match [-engine1 SPEC] [-engine2 SPEC] [-games N] [-concurrency N]
+ *       [-openings FILE] [-randomplies N] [-book FILE] [-bookplies N]
+ *       [-save FILE] [-sprt ELO0,ELO1] [-alpha A] [-beta B]
+ *
+ * See EngineConfig for the engine specifications.
+ */
+func RunMatch(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("match", flag.ContinueOnError)
+	engine1 := flags.String("engine1", "depth=3", "first engine")
+	engine2 := flags.String("engine2", "depth=2", "second engine")
+	games := flags.Int("games", 100, "number of games, rounded up to pairs")
+	concurrency := flags.Int("concurrency", runtime.NumCPU(), "number of games played in parallel")
+	openingsFile := flags.String("openings", "", "openings file, defaults to all starting layouts")
+	randomPlies := flags.Int("randomplies", 2, "random moves played from every opening without book")
+	bookFile := flags.String("book", "", "vary openings by moves from this book")
+	bookPlies := flags.Int("bookplies", 8, "maximum number of book moves played from every opening")
+	saveFile := flags.String("save", "", "write all game records to file")
+	sprt := flags.String("sprt", "", "stop early by SPRT between ELO0,ELO1")
+	alpha := flags.Float64("alpha", 0.05, "SPRT false positive rate")
+	beta := flags.Float64("beta", 0.05, "SPRT false negative rate")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	match := Match{Games: (*games + 1) / 2 * 2, Concurrency: *concurrency,
+		BookPlies: *bookPlies, RandomPlies: *randomPlies, Alpha: *alpha, Beta: *beta}
+	for i, spec := range []string{*engine1, *engine2} {
+		config, err := ParseEngineConfig(spec)
+		if err != nil {
+			return err
+		}
+		match.Engines[i] = config
+	}
+	for _, config := range match.Engines {
+		/* Fail early on engines that cannot even start */
+		player, err := config.Start()
+		if err != nil {
+			return err
+		}
+		player.Close()
+	}
+	if match.Engines[0].Name == match.Engines[1].Name {
+		match.Engines[0].Name += " (1)"
+		match.Engines[1].Name += " (2)"
+	}
+	if match.Games <= 0 || match.Concurrency <= 0 {
+		return errors.New("match: need a positive number of games and concurrency")
+	}
+
+	if *sprt != "" {
+		if _, err := fmt.Sscanf(*sprt, "%g,%g", &match.Elo0, &match.Elo1); err != nil || match.Elo0 >= match.Elo1 {
+			return fmt.Errorf("match: invalid SPRT bounds %q, expected ELO0,ELO1 with ELO0 < ELO1", *sprt)
+		}
+	}
+
+	/* Collect openings, in a random order so short matches use a variety */
+	var openings []string
+	if *openingsFile != "" {
+		file, err := os.Open(*openingsFile)
+		if err != nil {
+			return err
+		}
+		openings, err = ReadOpenings(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		if len(openings) == 0 {
+			return errors.New("match: no openings in " + *openingsFile)
+		}
+	} else {
+		for _, fen := range StartingLayouts {
+			openings = append(openings, fen)
+		}
+		sort.Strings(openings)
+	}
+	rand.Shuffle(len(openings), func(i, j int) { openings[i], openings[j] = openings[j], openings[i] })
+	match.Openings = openings
+
+	if *bookFile != "" {
+		book, err := LoadOpeningBook(*bookFile)
+		if err != nil {
+			return err
+		}
+		match.Book = book
+	}
+
+	if *saveFile != "" {
+		file, err := os.Create(*saveFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		record := bufio.NewWriter(file)
+		defer record.Flush()
+		match.Record = record
+	}
+
+	score, err := match.Run(out)
+	if err != nil {
+		return err
+	}
+
+	elo, margin := score.Elo()
+	fmt.Fprintf(out, "Finished %d games: %d wins, %d draws, %d losses\n", score.Games(), score.Wins, score.Draws, score.Losses)
+	fmt.Fprintf(out, "Elo difference: %.1f +/- %.1f\n", elo, margin)
+	if match.sprt() {
+		llr, lower, upper := score.LLR(match.Elo0, match.Elo1, match.Alpha, match.Beta)
+		verdict := "inconclusive"
+		if llr >= upper {
+			verdict = "H1 accepted"
+		} else if llr <= lower {
+			verdict = "H0 accepted"
+		}
+		fmt.Fprintf(out, "SPRT elo0 %g elo1 %g: LLR %.2f (%.2f, %.2f) %s\n", match.Elo0, match.Elo1, llr, lower, upper, verdict)
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchScoreElo(t *testing.T) {
+	tests := []struct {
+		score  MatchScore
+		elo    float64
+		margin float64
+	}{
+		{MatchScore{60, 20, 20}, 147.19, 66.01},
+		{MatchScore{10, 0, 10}, 0, 163.32},
+		{MatchScore{30, 40, 30}, 0, 53.16},
+		{MatchScore{20, 60, 20}, 0, 43.29},
+	}
+
+	for _, test := range tests {
+		elo, margin := test.score.Elo()
+		if math.Abs(elo-test.elo) > 0.01 || math.Abs(margin-test.margin) > 0.01 {
+			t.Errorf("%v: Elo %.2f +/- %.2f, expected %.2f +/- %.2f", &test.score, elo, margin, test.elo, test.margin)
+		}
+	}
+
+	/* One side scoring everything */
+	for _, score := range []MatchScore{{5, 0, 0}, {0, 0, 5}} {
+		elo, margin := score.Elo()
+		if !math.IsInf(elo, 0) || !math.IsInf(margin, 1) {
+			t.Errorf("%v: Elo %v +/- %v, expected infinite", &score, elo, margin)
+		}
+	}
+
+	/* No games at all */
+	var score MatchScore
+	if elo, margin := score.Elo(); elo != 0 || !math.IsInf(margin, 1) || score.Ratio() != 0.5 {
+		t.Errorf("%v: Elo %v +/- %v", &score, elo, margin)
+	}
+}
+
+func TestMatchScoreLLR(t *testing.T) {
+	tests := []struct {
+		score        MatchScore
+		elo0, elo1   float64
+		alpha, beta  float64
+		llr          float64
+		lower, upper float64
+	}{
+		{MatchScore{60, 20, 20}, 0, 5, 0.05, 0.05, 0.879, -2.944, 2.944},
+		{MatchScore{20, 60, 20}, 0, 5, 0.05, 0.05, -0.026, -2.944, 2.944},
+		{MatchScore{50, 0, 50}, -5, 5, 0.05, 0.05, 0, -2.944, 2.944},
+		{MatchScore{}, 0, 5, 0.1, 0.05, 0, -2.890, 2.251},
+	}
+
+	for _, test := range tests {
+		llr, lower, upper := test.score.LLR(test.elo0, test.elo1, test.alpha, test.beta)
+		if math.Abs(llr-test.llr) > 0.001 || math.Abs(lower-test.lower) > 0.001 || math.Abs(upper-test.upper) > 0.001 {
+			t.Errorf("%v: LLR %.3f (%.3f, %.3f), expected %.3f (%.3f, %.3f)",
+				&test.score, llr, lower, upper, test.llr, test.lower, test.upper)
+		}
+	}
+}
+
+func TestParseEngineConfig(t *testing.T) {
+	config := func(changes func(*EngineConfig)) EngineConfig {
+		config := EngineConfig{Features: DefaultSearchFeatures, Algorithm: "alphabeta", Exploration: DefaultExploration}
+		changes(&config)
+		return config
+	}
+
+	tests := []struct {
+		spec     string
+		expected EngineConfig
+	}{
+		{"depth=4", config(func(c *EngineConfig) { c.Name, c.Depth = "depth=4", 4 })},
+		{"name=fast,movetime=50", config(func(c *EngineConfig) { c.Name, c.MoveTime = "fast", 50*time.Millisecond })},
+		{"tc=10+0.1", config(func(c *EngineConfig) { c.Name, c.Time, c.Increment = "tc=10+0.1", 10*time.Second, 100*time.Millisecond })},
+		{"eval=w.json,book=b.bin", config(func(c *EngineConfig) {
+			c.Name, c.EvalFile, c.BookFile, c.MoveTime = "eval=w.json,book=b.bin", "w.json", "b.bin", defaultMatchMoveTime
+		})},
+		{"cmd=./ataxx uai", config(func(c *EngineConfig) {
+			c.Name, c.Command, c.MoveTime = "cmd=./ataxx uai", []string{"./ataxx", "uai"}, defaultMatchMoveTime
+		})},
+		{"algo=mcts,iterations=500,policy=greedy,c=0.7", config(func(c *EngineConfig) {
+			c.Name, c.Algorithm, c.Iterations, c.Policy, c.Exploration = "algo=mcts,iterations=500,policy=greedy,c=0.7", "mcts", 500, PlayoutGreedy, 0.7
+		})},
+		{"depth=2,pvs=off,lmr=off", config(func(c *EngineConfig) {
+			c.Name, c.Depth, c.Features.PVS, c.Features.LMR = "depth=2,pvs=off,lmr=off", 2, false, false
+		})},
+	}
+
+	for _, test := range tests {
+		config, err := ParseEngineConfig(test.spec)
+		if err != nil {
+			t.Errorf("%s: %v", test.spec, err)
+		} else if !reflect.DeepEqual(config, test.expected) {
+			t.Errorf("%s: got %+v, expected %+v", test.spec, config, test.expected)
+		}
+	}
+
+	for _, spec := range []string{"depth", "depth=", "depth=0", "depth=x", "movetime=x", "tc=-1",
+		"colour=x", "algo=minimax", "iterations=0", "policy=smart", "c=-1", "pvs=maybe", "algo=mcts,depth=3"} {
+		if _, err := ParseEngineConfig(spec); err == nil {
+			t.Errorf("%s: accepted", spec)
+		}
+	}
+}
+
+func TestReadOpenings(t *testing.T) {
+	openings, err := ReadOpenings(strings.NewReader("# comment\n\nx5o/7/7/7/7/7/o5x x 0 1\n"))
+	if err != nil || len(openings) != 1 {
+		t.Fatalf("got %v, %v", openings, err)
+	}
+
+	/* O has no pieces left */
+	if _, err := ReadOpenings(strings.NewReader("x6/7/7/7/7/7/7 o 0 1\n")); err == nil {
+		t.Error("finished opening accepted")
+	}
+}
+
+/* Openings only leading to finished positions give up, rather than trying
+ * forever.
+ */
+func TestMatchOpeningAttempts(t *testing.T) {
+	match := Match{Openings: []string{"x6/7/7/7/7/7/7 o 0 1"}, RandomPlies: 0}
+	if _, err := match.opening(0); err == nil {
+		t.Error("finished opening accepted")
+	}
+
+	match.Openings = []string{StartFEN}
+	if fen, err := match.opening(0); err != nil || fen != StartFEN {
+		t.Errorf("got %s, %v", fen, err)
+	}
+}
@@ -0,0 +1,402 @@
+/* Monte Carlo tree search */
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+/* How moves are chosen while playing out a game to its end */
+type PlayoutPolicy int
+
+const (
+	/* Any legal move with equal probability */
+	PlayoutRandom PlayoutPolicy = iota
+
+	/* The move gaining the most pieces, singles counting one extra, with
+	 * ties broken randomly.
+	 */
+	PlayoutGreedy
+)
+
+/* Exploration constant of UCT, the theoretical value for rewards in [0, 1] */
+const DefaultExploration = math.Sqrt2
+
+/* Iterations per move when neither iterations nor time are limited */
+const DefaultMCTSIterations = 10000
+
+/* Longest playout. As jumps do not fill the board, a playout could go on
+ * forever, so it is cut off and judged by the pieces on the board.
+ */
+const maxPlayoutPlies = 200
+
+/* Parse the name of a playout policy */
+func ParsePlayoutPolicy(name string) (PlayoutPolicy, error) {
+	switch name {
+	case "random":
+		return PlayoutRandom, nil
+	case "greedy":
+		return PlayoutGreedy, nil
+	}
+
+	return PlayoutRandom, fmt.Errorf("mcts: unknown playout policy %q", name)
+}
+
+func (policy PlayoutPolicy) String() string {
+	if policy == PlayoutGreedy {
+		return "greedy"
+	}
+	return "random"
+}
+
+/* A node of the search tree, standing for the position after its move.
+ *
+ * Moves are generated when a node is first selected, then turned into
+ * children one by one. A player that has to pass gets the PassMove from
+ * Moves like any other move, so the tree continues through passes. The
+ * reward is the sum of the playout results from the point of view of the
+ * player making the move: 1 for a win, 0.5 for a draw.
+ */
+type mctsNode struct {
+	move     AtaxxMove
+	player   bool
+	parent   *mctsNode
+	children []*mctsNode
+	untried  []AtaxxMove
+	expanded bool
+	visits   int
+	reward   float64
+}
+
+/* Monte Carlo tree search using UCT
+ *
+ * Every iteration descends the tree by picking the child maximizing
+ *
+ *  reward/visits + Exploration * sqrt(ln(parent visits) / visits)
+ *
+ * adds a single new node, plays out the game from there using the playout
+ * policy and credits the result to all nodes on the way. The move played is
+ * the most visited child of the root.
+ *
+ * The tree is kept between searches: when the next search starts from a
+ * position already in the tree, e.g. after our move and the reply of the
+ * opponent, that subtree becomes the new root. Reset drops the tree.
+ *
+ * Unlike Searcher, a single MCTS is not safe for concurrent use.
+ */
+type MCTS struct {
+	Exploration float64
+	Policy      PlayoutPolicy
+
+	/* Iterations per search, zero meaning only the time limit applies */
+	Iterations int
+
+	/* Root of the tree and the position it stands for */
+	root       *mctsNode
+	rootBoard  MoveGameboard
+	rootPlayer bool
+
+	random *rand.Rand
+}
+
+/* Create a search with the default settings */
+func NewMCTS() *MCTS {
+	return &MCTS{
+		Exploration: DefaultExploration,
+		Policy:      PlayoutRandom,
+		random:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+/* Drop the tree, e.g. at the start of a new game */
+func (mcts *MCTS) Reset() {
+	mcts.root, mcts.rootBoard = nil, nil
+}
+
+/* Make the given position the root of the tree, reusing the part of the old
+ * tree found within two plies of the old root.
+ */
+func (mcts *MCTS) setRoot(game MoveGameboard, maximizingPlayer bool) {
+	hash := hashGameboard(game, maximizingPlayer)
+	root := mcts.findRoot(hash)
+	if root == nil {
+		root = &mctsNode{move: PassMove, player: !maximizingPlayer}
+	}
+	root.parent = nil
+
+	mcts.root = root
+	mcts.rootBoard = cloneGameboard(game)
+	mcts.rootPlayer = maximizingPlayer
+}
+
+/* Find the node of the position with the given hash in the old tree */
+func (mcts *MCTS) findRoot(hash uint64) *mctsNode {
+	if mcts.root == nil {
+		return nil
+	}
+	board, player := mcts.rootBoard, mcts.rootPlayer
+	if hashGameboard(board, player) == hash {
+		return mcts.root
+	}
+
+	for _, child := range mcts.root.children {
+		captured := board.MakeMove(child.move, player)
+		found := hashGameboard(board, !player) == hash
+		if found {
+			board.UnmakeMove(child.move, player, captured)
+			return child
+		}
+
+		for _, grandchild := range child.children {
+			reply := board.MakeMove(grandchild.move, !player)
+			found = hashGameboard(board, player) == hash
+			board.UnmakeMove(grandchild.move, !player, reply)
+			if found {
+				board.UnmakeMove(child.move, player, captured)
+				return grandchild
+			}
+		}
+		board.UnmakeMove(child.move, player, captured)
+	}
+
+	return nil
+}
+
+/* Search a position, for the number of iterations or the time budget given
+ * by the limits, whichever is reached first. The depth limit is ignored.
+ *
+ * The score of the result is X's expected result p turned into hundredths
+ * of a piece as 100*ln(p/(1-p)), the inverse of the sigmoid used in tuning.
+ * The depth is the length of the principal variation, which follows the most
+ * visited children, and nodes counts the iterations.
+ */
+func (mcts *MCTS) Search(ctx context.Context, game MoveGameboard, maximizingPlayer bool, limits SearchLimits) SearchResult {
+	start := time.Now()
+	mcts.setRoot(game, maximizingPlayer)
+
+	budget := limits.Budget()
+	iterations := mcts.Iterations
+	if iterations == 0 && budget == 0 {
+		iterations = DefaultMCTSIterations
+	}
+
+	board := cloneGameboard(game)
+	count, selDepth := 0, 0
+	for iterations == 0 || count < iterations {
+		/* Reading the clock is relatively expensive */
+		if count&63 == 0 && count > 0 {
+			if ctx.Err() != nil || (budget > 0 && time.Since(start) >= budget) {
+				break
+			}
+		}
+
+		if depth := mcts.iterate(board, maximizingPlayer); depth > selDepth {
+			selDepth = depth
+		}
+		count++
+	}
+
+	result := SearchResult{Move: PassMove, Incomplete: ctx.Err() != nil}
+	pv := mcts.principalVariation()
+	if len(pv) > 0 {
+		result.Move = pv[0]
+	}
+
+	/* Expected result of X */
+	expected := 0.5
+	if best := mcts.bestChild(mcts.root); best != nil {
+		expected = best.reward / float64(best.visits)
+		if !maximizingPlayer {
+			expected = 1 - expected
+		}
+	} else if game.Finished() {
+		expected = playoutResult(game.Score())
+	}
+	result.Score = winRateScore(expected)
+	result.Depth = len(pv)
+
+	elapsed := time.Since(start)
+	result.Info = SearchInfo{Depth: len(pv), SelDepth: selDepth, Score: result.Score, PV: pv, Nodes: count, Time: elapsed}
+	if elapsed > 0 {
+		result.Info.NPS = int(float64(count) / elapsed.Seconds())
+	}
+
+	return result
+}
+
+/* Perform a single iteration on the board of the root position, returning
+ * the depth of the tree reached. The board is restored afterwards.
+ */
+func (mcts *MCTS) iterate(board MoveGameboard, maximizingPlayer bool) int {
+	type performed struct {
+		move     AtaxxMove
+		player   bool
+		captured SingleBitboard
+	}
+	path := make([]performed, 0, 16)
+	play := func(move AtaxxMove, player bool) {
+		path = append(path, performed{move, player, board.MakeMove(move, player)})
+	}
+
+	/* Selection */
+	node, player := mcts.root, maximizingPlayer
+	for node.expanded && len(node.untried) == 0 && len(node.children) > 0 {
+		node = mcts.selectChild(node)
+		play(node.move, player)
+		player = !player
+	}
+
+	/* Expansion */
+	if !node.expanded {
+		node.untried = board.Moves(player)
+		node.expanded = true
+	}
+	if len(node.untried) > 0 {
+		i := mcts.random.Intn(len(node.untried))
+		move := node.untried[i]
+		node.untried[i] = node.untried[len(node.untried)-1]
+		node.untried = node.untried[:len(node.untried)-1]
+
+		child := &mctsNode{move: move, player: player, parent: node}
+		node.children = append(node.children, child)
+		play(move, player)
+		player = !player
+		node = child
+	}
+
+	/* Playout */
+	result := mcts.playout(board, player)
+
+	/* Backpropagation */
+	for ; node != nil; node = node.parent {
+		node.visits++
+		if node.player {
+			node.reward += result
+		} else {
+			node.reward += 1 - result
+		}
+	}
+
+	for i := len(path) - 1; i >= 0; i-- {
+		board.UnmakeMove(path[i].move, path[i].player, path[i].captured)
+	}
+	return len(path)
+}
+
+/* Pick the child to descend into, see MCTS */
+func (mcts *MCTS) selectChild(node *mctsNode) *mctsNode {
+	logVisits := math.Log(float64(node.visits))
+
+	var best *mctsNode
+	bestValue := math.Inf(-1)
+	for _, child := range node.children {
+		visits := float64(child.visits)
+		value := child.reward/visits + mcts.Exploration*math.Sqrt(logVisits/visits)
+		if value > bestValue {
+			best, bestValue = child, value
+		}
+	}
+
+	return best
+}
+
+/* The most visited child of a node, nil if there is none */
+func (mcts *MCTS) bestChild(node *mctsNode) *mctsNode {
+	var best *mctsNode
+	for _, child := range node.children {
+		if best == nil || child.visits > best.visits {
+			best = child
+		}
+	}
+
+	return best
+}
+
+/* Follow the most visited children from the root */
+func (mcts *MCTS) principalVariation() []AtaxxMove {
+	pv := make([]AtaxxMove, 0)
+	for node := mcts.bestChild(mcts.root); node != nil && len(pv) < MaxSearchDepth; node = mcts.bestChild(node) {
+		pv = append(pv, node.move)
+	}
+
+	return pv
+}
+
+/* Play out the game from the current position, returning the result for X,
+ * see playoutResult. Forced passes are played like any other move, only a
+ * finished game has no moves. The board is restored afterwards.
+ */
+func (mcts *MCTS) playout(board MoveGameboard, player bool) float64 {
+	moves := make([]AtaxxMove, 0, maxPlayoutPlies)
+	captures := make([]SingleBitboard, 0, maxPlayoutPlies)
+
+	for len(moves) < maxPlayoutPlies {
+		available := board.Moves(player)
+		if len(available) == 0 {
+			break
+		}
+
+		move := mcts.playoutMove(board, available, player)
+		captures = append(captures, board.MakeMove(move, player))
+		moves = append(moves, move)
+		player = !player
+	}
+	result := playoutResult(board.Score())
+
+	for i := len(moves) - 1; i >= 0; i-- {
+		player = !player
+		board.UnmakeMove(moves[i], player, captures[i])
+	}
+	return result
+}
+
+/* Choose a move during a playout, according to the policy */
+func (mcts *MCTS) playoutMove(board MoveGameboard, moves []AtaxxMove, player bool) AtaxxMove {
+	if mcts.Policy != PlayoutGreedy {
+		return moves[mcts.random.Intn(len(moves))]
+	}
+
+	/* Pick uniformly among the best moves seen so far */
+	var best AtaxxMove
+	bestGain, ties := -1, 0
+	for _, move := range moves {
+		captured := board.MakeMove(move, player)
+		board.UnmakeMove(move, player, captured)
+
+		gain := captured.PiecesPlaced()
+		if move.IsSingle() {
+			gain++
+		}
+		if gain > bestGain {
+			best, bestGain, ties = move, gain, 1
+		} else if gain == bestGain {
+			ties++
+			if mcts.random.Intn(ties) == 0 {
+				best = move
+			}
+		}
+	}
+
+	return best
+}
+
+/* Result of a game for X judging by the piece difference: 1 for a win, 0.5
+ * for a draw and 0 for a loss.
+ */
+func playoutResult(score int) float64 {
+	if score > 0 {
+		return 1
+	} else if score < 0 {
+		return 0
+	}
+	return 0.5
+}
+
+/* Convert an expected result into a score, see MCTS.Search */
+func winRateScore(expected float64) int {
+	expected = math.Max(0.001, math.Min(0.999, expected))
+	return int(math.Round(PieceValue * math.Log(expected/(1-expected))))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+/* O is walled in behind the blockers and has to pass, after which X fills
+ * its half of the board and wins, although O is ahead for now.
+ */
+const mctsBlockadeFEN = "ooooooo/ooooooo/-------/-------/xxxxxxx/7/7 o 0 1"
+
+func TestMCTSPlayoutPass(t *testing.T) {
+	board, state, _ := ParseBitboardFEN(mctsBlockadeFEN)
+	mcts := NewMCTS()
+	mcts.Policy = PlayoutGreedy
+
+	if result := mcts.playout(board, state.MaximizingPlayer); result != 1 {
+		t.Errorf("playout result %v, expected X to win", result)
+	}
+	if board.FEN(state) != mctsBlockadeFEN {
+		t.Errorf("board changed to %s", board.FEN(state))
+	}
+}
+
+func TestMCTSSearchPass(t *testing.T) {
+	board, state, _ := ParseBitboardFEN(mctsBlockadeFEN)
+	mcts := NewMCTS()
+	mcts.Iterations = 200
+	result := mcts.Search(context.Background(), board, state.MaximizingPlayer, SearchLimits{})
+
+	if result.Move != PassMove || result.Score <= 0 {
+		t.Errorf("move %v score %d, expected a pass and X winning", result.Move, result.Score)
+	}
+
+	/* The tree continues through the pass */
+	if children := mcts.root.children; len(children) != 1 || children[0].move != PassMove || len(children[0].children) == 0 {
+		t.Errorf("root children %v", children)
+	}
+}
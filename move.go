@@ -0,0 +1,452 @@
+/* Ataxx moves, move generation and algebraic notation */
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+/* A single Ataxx move.
+ *
+ * Squares are cell indexes (7*y + x), the same ordering used by the boards.
+ *
+ * There are three kinds of moves:
+ *  single: a piece subdivides to a neighbouring cell, From equals To.
+ *  double: a piece jumps two cells away, leaving From empty.
+ *  pass:   the player cannot move, both From and To are -1.
+ *
+ * In algebraic notation files are named a to g (left to right) and ranks 7 to
+ * 1 (top to bottom). Singles are written as their target square ("g2"),
+ * doubles as source and target ("a1c3") and a pass as "0000".
+ */
+type AtaxxMove struct {
+	From int8
+	To   int8
+}
+
+/* The move made by a player who cannot move */
+var PassMove = AtaxxMove{-1, -1}
+
+/* Construct a single (subdividing) move to the target cell */
+func NewSingleMove(to int) AtaxxMove {
+	return AtaxxMove{int8(to), int8(to)}
+}
+
+/* Construct a double (jumping) move */
+func NewDoubleMove(from, to int) AtaxxMove {
+	return AtaxxMove{int8(from), int8(to)}
+}
+
+/* Return true if this move is a pass */
+func (move AtaxxMove) IsPass() bool {
+	return move.To < 0
+}
+
+/* Return true if this move subdivides a piece */
+func (move AtaxxMove) IsSingle() bool {
+	return move.To >= 0 && move.From == move.To
+}
+
+/* Return true if this move jumps a piece */
+func (move AtaxxMove) IsDouble() bool {
+	return move.To >= 0 && move.From != move.To
+}
+
+/* Format move in algebraic notation */
+func (move AtaxxMove) String() string {
+	if move.IsPass() {
+		return "0000"
+	}
+	if move.IsSingle() {
+		return SquareString(int(move.To))
+	}
+
+	return SquareString(int(move.From)) + SquareString(int(move.To))
+}
+
+/* Returned by ParseMove and ParseSquare for malformed notation */
+var ErrInvalidNotation = errors.New("move: invalid notation")
+
+/* Parse a move in algebraic notation
+ *
+ * This only checks the notation, not wether the move is legal on some board.
+ * Doubles are required to actually be 2 cells away, anything closer should
+ * have been written as a single.
+ */
+func ParseMove(notation string) (AtaxxMove, error) {
+	switch len(notation) {
+	case 4:
+		if notation == "0000" {
+			return PassMove, nil
+		}
+		from, err := ParseSquare(notation[:2])
+		if err != nil {
+			return PassMove, err
+		}
+		to, err := ParseSquare(notation[2:])
+		if err != nil {
+			return PassMove, err
+		}
+		if cellDistance(from, to) != 2 {
+			return PassMove, fmt.Errorf("%w: %q is not a double move", ErrInvalidNotation, notation)
+		}
+		return NewDoubleMove(from, to), nil
+
+	case 2:
+		to, err := ParseSquare(notation)
+		if err != nil {
+			return PassMove, err
+		}
+		return NewSingleMove(to), nil
+	}
+
+	return PassMove, fmt.Errorf("%w %q", ErrInvalidNotation, notation)
+}
+
+/* Parse a square in algebraic notation (e.g. "a1") into a cell index */
+func ParseSquare(square string) (int, error) {
+	if len(square) != 2 || square[0] < 'a' || square[0] > 'g' || square[1] < '1' || square[1] > '7' {
+		return 0, fmt.Errorf("%w: invalid square %q", ErrInvalidNotation, square)
+	}
+
+	x := int(square[0] - 'a')
+	y := 7 - int(square[1]-'0')
+
+	return y*7 + x, nil
+}
+
+/* Format a cell index in algebraic notation */
+func SquareString(cell int) string {
+	return fmt.Sprintf("%c%d", 'a'+cell%7, 7-cell/7)
+}
+
+/* Chebyshev distance between two cells, 1 for singles and 2 for doubles */
+func cellDistance(a, b int) int {
+	dist := func(a, b int) int {
+		if a < b {
+			return b - a
+		}
+		return a - b
+	}
+
+	dstX := dist(a%7, b%7)
+	dstY := dist(a/7, b/7)
+	if dstX > dstY {
+		return dstX
+	}
+	return dstY
+}
+
+/* Returned by ParseLegalMove for moves that cannot be played */
+var ErrIllegalMove = errors.New("move: illegal move")
+
+/* Reasons for a move being illegal, all of them wrap ErrIllegalMove */
+var (
+	ErrOutOfBounds    = fmt.Errorf("%w: cell out of bounds", ErrIllegalMove)
+	ErrTargetOccupied = fmt.Errorf("%w: target cell is not empty", ErrIllegalMove)
+	ErrNotYourPiece   = fmt.Errorf("%w: source cell does not hold your piece", ErrIllegalMove)
+	ErrTooFar         = fmt.Errorf("%w: target cell out of reach", ErrIllegalMove)
+)
+
+/* Parse a move in algebraic notation and check it against the legal moves
+ * available on the given board.
+ */
+func ParseLegalMove(game MoveGameboard, maximizingPlayer bool, notation string) (AtaxxMove, error) {
+	move, err := ParseMove(notation)
+	if err != nil {
+		return move, err
+	}
+
+	if !isLegalMove(game, maximizingPlayer, move) {
+		return move, fmt.Errorf("%w %q", ErrIllegalMove, notation)
+	}
+
+	return move, nil
+}
+
+/* Check a move against this board, explaining why it is illegal.
+ *
+ * Returns nil for legal moves, otherwise one of the errors above.
+ */
+func (board *AtaxxBitboard) CheckMove(move AtaxxMove, maximizingPlayer bool) error {
+	if move.IsPass() {
+		if !isLegalMove(board, maximizingPlayer, move) {
+			return fmt.Errorf("%w: cannot pass while moves are available", ErrIllegalMove)
+		}
+		return nil
+	}
+	if move.From < 0 || move.From > 48 || move.To > 48 {
+		return ErrOutOfBounds
+	}
+
+	movingPlayer := board.minimizingPlayer
+	if maximizingPlayer {
+		movingPlayer = board.maximizingPlayer
+	}
+
+	target := SingleBitboard(1) << uint(move.To)
+	if (board.maximizingPlayer|board.minimizingPlayer|board.blockers)&target != 0 {
+		return ErrTargetOccupied
+	}
+	if move.IsSingle() && movingPlayer&subdivideMask[move.To] == 0 {
+		return ErrTooFar
+	}
+	if move.IsDouble() {
+		if movingPlayer&(1<<uint(move.From)) == 0 {
+			return ErrNotYourPiece
+		}
+		if cellDistance(int(move.From), int(move.To)) != 2 {
+			return ErrTooFar
+		}
+	}
+
+	/* Anything else, e.g. moving in a finished game */
+	if !isLegalMove(board, maximizingPlayer, move) {
+		return ErrIllegalMove
+	}
+
+	return nil
+}
+
+/* Check wether a move is legal in the given position */
+func isLegalMove(game MoveGameboard, maximizingPlayer bool, move AtaxxMove) bool {
+	for _, candidate := range game.Moves(maximizingPlayer) {
+		if candidate == move {
+			return true
+		}
+	}
+
+	return false
+}
+
+/* Return all legal moves the given player can make on this board.
+ *
+ * The moves are returned in the same order as the boards of NextBoards.
+ * For every empty cell the jumps come first, followed by the single.
+ *
+ * If the player cannot move while empty cells remain, the only move is a
+ * pass. If the game is finished, no moves are returned.
+ */
+func (board *AtaxxBoard) Moves(maximizingPlayer bool) []AtaxxMove {
+	moves := make([]AtaxxMove, 0)
+
+	if board.Finished() {
+		return moves
+	}
+
+	var color int8 = 1
+	if !maximizingPlayer {
+		color = -1
+	}
+
+	for y := 0; y < 7; y++ {
+		for x := 0; x < 7; x++ {
+			if board[y][x] != 0 {
+				continue
+			}
+			hasSubdivision := false
+
+			/* Iterate neighbourhood, see NextBoards for details */
+			for iy := -2; iy <= 2; iy++ {
+				if iy+y < 0 || iy+y >= 7 {
+					continue
+				}
+				for ix := -2; ix <= 2; ix++ {
+					if ix+x < 0 || ix+x >= 7 {
+						continue
+					}
+					if board[iy+y][ix+x] != color {
+						continue
+					}
+
+					if ix >= -1 && ix <= 1 && iy >= -1 && iy <= 1 {
+						hasSubdivision = true
+					} else {
+						moves = append(moves, NewDoubleMove((iy+y)*7+ix+x, y*7+x))
+					}
+				}
+			}
+
+			if hasSubdivision {
+				moves = append(moves, NewSingleMove(y*7+x))
+			}
+		}
+	}
+
+	/* Forced pass */
+	if len(moves) == 0 {
+		moves = append(moves, PassMove)
+	}
+
+	return moves
+}
+
+/* Perform a move in place.
+ *
+ * Returns the cells infected by the move, which UnmakeMove needs to restore
+ * the original board.
+ * The move is assumed to be legal.
+ */
+func (board *AtaxxBoard) MakeMove(move AtaxxMove, maximizingPlayer bool) (captured SingleBitboard) {
+	if move.IsPass() {
+		return 0
+	}
+
+	var color int8 = 1
+	if !maximizingPlayer {
+		color = -1
+	}
+
+	x, y := int(move.To)%7, int(move.To)/7
+	board[y][x] = color
+	if move.IsDouble() {
+		board[move.From/7][move.From%7] = 0
+	}
+
+	/* Infect neighbourhood cells */
+	for iy := -1; iy <= 1; iy++ {
+		if y+iy < 0 || y+iy >= 7 {
+			continue
+		}
+		for ix := -1; ix <= 1; ix++ {
+			if x+ix < 0 || x+ix >= 7 {
+				continue
+			}
+			if board[y+iy][x+ix] == -color {
+				board[y+iy][x+ix] = color
+				captured |= SingleBitboard(1) << uint((y+iy)*7+x+ix)
+			}
+		}
+	}
+
+	return captured
+}
+
+/* Undo a move previously performed by MakeMove */
+func (board *AtaxxBoard) UnmakeMove(move AtaxxMove, maximizingPlayer bool, captured SingleBitboard) {
+	if move.IsPass() {
+		return
+	}
+
+	var color int8 = 1
+	if !maximizingPlayer {
+		color = -1
+	}
+
+	/* Give infected cells back to the opponent */
+	for cell := 0; captured != 0; cell++ {
+		if captured&1 != 0 {
+			board[cell/7][cell%7] = -color
+		}
+		captured >>= 1
+	}
+
+	board[move.To/7][move.To%7] = 0
+	if move.IsDouble() {
+		board[move.From/7][move.From%7] = color
+	}
+}
+
+/* Return all legal moves the given player can make on this bitboard.
+ *
+ * Like NextBoards this uses the precomputed neighbourhood masks, and returns
+ * the moves in the same order: jumps first, then the single, for every empty
+ * cell.
+ *
+ * If the player cannot move while empty cells remain, the only move is a
+ * pass. If the game is finished, no moves are returned.
+ */
+func (board *AtaxxBitboard) Moves(maximizingPlayer bool) []AtaxxMove {
+	moves := make([]AtaxxMove, 0)
+
+	if board.Finished() {
+		return moves
+	}
+
+	movingPlayer := board.minimizingPlayer
+	if maximizingPlayer {
+		movingPlayer = board.maximizingPlayer
+	}
+	emptyCells := (^(board.maximizingPlayer | board.minimizingPlayer | board.blockers)) & ((1 << 49) - 1)
+
+	for bit := uint(0); bit < 49; bit++ {
+		if (emptyCells&(1<<bit)) == 0 || movingPlayer&moveMask[bit] == 0 {
+			continue
+		}
+
+		/* Jumps, fetching the LSB until none remain */
+		jumpingMask := movingPlayer & jumpMask[bit]
+		for jumpingMask != 0 {
+			nextJump := (^jumpingMask + 1) & jumpingMask
+			moves = append(moves, NewDoubleMove(nextJump.FirstCell(), int(bit)))
+			jumpingMask ^= nextJump
+		}
+
+		/* Single */
+		if movingPlayer&subdivideMask[bit] != 0 {
+			moves = append(moves, NewSingleMove(int(bit)))
+		}
+	}
+
+	/* Forced pass */
+	if len(moves) == 0 {
+		moves = append(moves, PassMove)
+	}
+
+	return moves
+}
+
+/* Perform a move in place.
+ *
+ * Returns the pieces infected by the move, which UnmakeMove needs to restore
+ * the original board.
+ * The move is assumed to be legal.
+ */
+func (board *AtaxxBitboard) MakeMove(move AtaxxMove, maximizingPlayer bool) (captured SingleBitboard) {
+	if move.IsPass() {
+		return 0
+	}
+
+	movingPlayer, waitingPlayer := &board.minimizingPlayer, &board.maximizingPlayer
+	if maximizingPlayer {
+		movingPlayer, waitingPlayer = &board.maximizingPlayer, &board.minimizingPlayer
+	}
+
+	captured = *waitingPlayer & subdivideMask[move.To]
+	*movingPlayer |= (1 << uint(move.To)) | captured
+	*waitingPlayer &^= captured
+	if move.IsDouble() {
+		*movingPlayer &^= 1 << uint(move.From)
+	}
+	board.hash ^= zobristMove(move, maximizingPlayer, captured)
+
+	return captured
+}
+
+/* Undo a move previously performed by MakeMove */
+func (board *AtaxxBitboard) UnmakeMove(move AtaxxMove, maximizingPlayer bool, captured SingleBitboard) {
+	if move.IsPass() {
+		return
+	}
+
+	movingPlayer, waitingPlayer := &board.minimizingPlayer, &board.maximizingPlayer
+	if maximizingPlayer {
+		movingPlayer, waitingPlayer = &board.maximizingPlayer, &board.minimizingPlayer
+	}
+
+	*movingPlayer &^= (1 << uint(move.To)) | captured
+	*waitingPlayer |= captured
+	if move.IsDouble() {
+		*movingPlayer |= 1 << uint(move.From)
+	}
+	board.hash ^= zobristMove(move, maximizingPlayer, captured)
+}
+
+/* Return the index of the least significant bit set.
+ *
+ * Returns 64 for an empty bitboard.
+ */
+func (board SingleBitboard) FirstCell() int {
+	return bits.TrailingZeros64(uint64(board))
+}
@@ -0,0 +1,135 @@
+/* Move ordering */
+package main
+
+import "sort"
+
+/* Alpha-beta prunes best when the best move is searched first. Moves are
+ * generated with jumps ahead of singles, which are usually the worst moves,
+ * so the search orders them, most promising first:
+ *
+ *  1. the move stored in the transposition table for the position,
+ *  2. moves capturing pieces, by the number of pieces gained: two for every
+ *     capture plus one for a single, so singles come before jumps,
+ *  3. the killer moves of the ply, quiet moves that caused a cutoff in a
+ *     sibling node,
+ *  4. all other quiet moves, singles first, then by their history: how
+ *     often and how deep they caused cutoffs anywhere in the tree.
+ */
+
+/* Ranks of the tiers above, most important first */
+const (
+	orderHash    = 1 << 30
+	orderCapture = 1 << 20
+	orderKiller  = 1 << 10
+	orderSingle  = 1
+)
+
+/* History scores are halved once any of them exceeds this */
+const historyLimit = 1 << 20
+
+/* Killer moves and history of a search, see orderMoves */
+type moveHistory struct {
+	killers [MaxSearchDepth + 1][2]AtaxxMove
+	scores  [2][49][49]int
+}
+
+/* Create an empty history. Killer slots hold PassMove while unused, which
+ * never competes with other moves.
+ */
+func newMoveHistory() *moveHistory {
+	history := &moveHistory{}
+	for ply := range history.killers {
+		history.killers[ply] = [2]AtaxxMove{PassMove, PassMove}
+	}
+
+	return history
+}
+
+/* Sort moves for searching, see the tiers above. hashMove is only used if
+ * found is set.
+ */
+func (search *Searcher) orderMoves(game MoveGameboard, moves []AtaxxMove, maximizingPlayer bool, hashMove AtaxxMove, found bool) {
+	if len(moves) < 2 || !search.OrderMoves {
+		return
+	}
+	if search.history == nil {
+		search.history = newMoveHistory()
+	}
+
+	type ranked struct {
+		move    AtaxxMove
+		rank    int
+		history int
+	}
+	rankings := make([]ranked, len(moves))
+	for i, move := range moves {
+		rankings[i] = ranked{move: move, rank: search.moveRank(game, move, maximizingPlayer, hashMove, found)}
+		if move != PassMove {
+			rankings[i].history = search.history.scores[boolIndex(maximizingPlayer)][move.From][move.To]
+		}
+	}
+
+	sort.SliceStable(rankings, func(i, j int) bool {
+		if rankings[i].rank != rankings[j].rank {
+			return rankings[i].rank > rankings[j].rank
+		}
+		return rankings[i].history > rankings[j].history
+	})
+	for i := range rankings {
+		moves[i] = rankings[i].move
+	}
+}
+
+/* Tier of a move, see orderMoves */
+func (search *Searcher) moveRank(game MoveGameboard, move AtaxxMove, maximizingPlayer bool, hashMove AtaxxMove, found bool) int {
+	if found && move == hashMove {
+		return orderHash
+	}
+
+	captured := game.MakeMove(move, maximizingPlayer)
+	game.UnmakeMove(move, maximizingPlayer, captured)
+
+	single := 0
+	if move.IsSingle() {
+		single = orderSingle
+	}
+	if captured != 0 {
+		return orderCapture + 2*captured.PiecesPlaced() + single
+	}
+
+	if search.ply < len(search.history.killers) {
+		for slot, killer := range search.history.killers[search.ply] {
+			if move == killer {
+				return orderKiller - slot
+			}
+		}
+	}
+
+	return single
+}
+
+/* Remember a quiet move causing a cutoff at the given depth as killer of the
+ * ply and in the history.
+ */
+func (search *Searcher) recordCutoff(move AtaxxMove, maximizingPlayer bool, depth int) {
+	if move == PassMove || search.history == nil {
+		return
+	}
+
+	if search.ply < len(search.history.killers) {
+		killers := &search.history.killers[search.ply]
+		if killers[0] != move {
+			killers[1], killers[0] = killers[0], move
+		}
+	}
+
+	scores := &search.history.scores[boolIndex(maximizingPlayer)]
+	scores[move.From][move.To] += depth * depth
+	if scores[move.From][move.To] > historyLimit {
+		for from := range scores {
+			for to := range scores[from] {
+				scores[from][to] /= 2
+			}
+		}
+	}
+}
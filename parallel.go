@@ -0,0 +1,101 @@
+/* Parallel search (Lazy SMP) */
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+/* Lazy SMP runs several searches of the same root position at once, all
+ * sharing the transposition table. Only the main search reports progress
+ * and picks the move, helpers merely fill the table with results that let
+ * the main search go deeper sooner.
+ *
+ * To keep the helpers from all searching the same tree in lockstep, every
+ * other helper starts one iteration deeper. Races on the table take care of
+ * the rest of the diversity.
+ *
+ * The main search keeps control of time, the helpers are stopped once it is
+ * done. With a single thread no helpers are started at all, so the search
+ * stays deterministic.
+ */
+
+/* Threads used by searches, see SetSearchThreads */
+var engineThreads = 1
+
+/* Change the number of threads used by all searches created afterwards */
+func SetSearchThreads(threads int) {
+	engineThreads = threads
+}
+
+/* Copy a board, so a helper can perform moves on its own copy */
+func cloneGameboard(game MoveGameboard) MoveGameboard {
+	switch board := game.(type) {
+	case *AtaxxBitboard:
+		clone := *board
+		return &clone
+	case *AtaxxBoard:
+		clone := *board
+		return &clone
+	}
+
+	panic(fmt.Sprintf("search: cannot copy %T", game))
+}
+
+/* Start the helpers of a search using more than one thread.
+ *
+ * Returns a function stopping the helpers, which returns once all of them are
+ * done.
+ */
+func (search *Searcher) startHelpers(game MoveGameboard, maximizingPlayer bool, maxDepth int) (stop func()) {
+	search.helpers = nil
+	if search.Threads <= 1 || search.transposition == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	var running sync.WaitGroup
+	for i := 1; i < search.Threads; i++ {
+		helper := &Searcher{transposition: search.transposition, Weights: search.Weights, SolveEmpty: search.SolveEmpty, SearchFeatures: search.SearchFeatures}
+		helper.done = done
+		helper.interruptible = true
+		search.helpers = append(search.helpers, helper)
+
+		root := cloneGameboard(game)
+		running.Add(1)
+		go func(skip int) {
+			defer running.Done()
+			helper.helperDeepening(root, maximizingPlayer, maxDepth, skip)
+		}(i % 2)
+	}
+
+	return func() {
+		close(done)
+		running.Wait()
+	}
+}
+
+/* Iterative deepening of a helper, starting skip iterations deeper than the
+ * main search. Runs until stopped or the maximum depth is searched.
+ */
+func (search *Searcher) helperDeepening(game MoveGameboard, maximizingPlayer bool, maxDepth int, skip int) {
+	board, _ := search.solverBoard(game)
+	for depth := 1 + skip; depth <= maxDepth && !search.stopped; depth++ {
+		search.iteration(game, board, maximizingPlayer, depth)
+	}
+}
+
+/* Number of nodes visited by a search and its helpers so far.
+ *
+ * Helpers publish their node count every so often while checking wether to
+ * stop, so their part lags behind slightly.
+ */
+func (search *Searcher) totalNodes() int {
+	nodes := search.nodes
+	for _, helper := range search.helpers {
+		nodes += int(atomic.LoadInt64(&helper.published))
+	}
+
+	return nodes
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+/* A search with helpers plays a legal move, leaves the board alone and
+ * stops all helpers before returning. Run with -race to check the sharing of
+ * the transposition table.
+ */
+func TestParallelSearch(t *testing.T) {
+	for _, fen := range searchPositions {
+		board, state, err := ParseBitboardFEN(fen)
+		if err != nil {
+			t.Fatalf("%s: %v", fen, err)
+		}
+
+		search := NewSearcher(NewBitTranspositionTable(1 << 16))
+		search.Book, search.Threads = nil, 4
+		result := search.IterativeDeepening(context.Background(), board, state.MaximizingPlayer, SearchLimits{MoveTime: 50 * time.Millisecond})
+
+		if err := board.CheckMove(result.Move, state.MaximizingPlayer); err != nil {
+			t.Errorf("%s: %v: %v", fen, result.Move, err)
+		}
+		if board.FEN(state) != fen {
+			t.Errorf("%s: board changed to %s", fen, board.FEN(state))
+		}
+		if result.Depth < 1 || result.Incomplete {
+			t.Errorf("%s: depth %d, incomplete %t", fen, result.Depth, result.Incomplete)
+		}
+
+		if len(search.helpers) != 3 {
+			t.Fatalf("%s: %d helpers", fen, len(search.helpers))
+		}
+		nodes := search.totalNodes()
+		time.Sleep(10 * time.Millisecond)
+		if search.totalNodes() != nodes {
+			t.Errorf("%s: helpers still searching", fen)
+		}
+	}
+}
+
+/* Cancelling stops the main search and the helpers alike */
+func TestParallelSearchCancel(t *testing.T) {
+	board := NewBitGame()
+	search := NewSearcher(NewBitTranspositionTable(1 << 16))
+	search.Book, search.Threads = nil, 4
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result := search.IterativeDeepening(ctx, board, true, SearchLimits{})
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("stopped after %v", elapsed)
+	}
+	if !result.Incomplete {
+		t.Error("result not marked incomplete")
+	}
+	if err := board.CheckMove(result.Move, true); err != nil {
+		t.Errorf("%v: %v", result.Move, err)
+	}
+}
@@ -0,0 +1,153 @@
+/* Perft, move generation performance and correctness testing */
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+/* Perft counts the number of leaf nodes of the game tree up to a given
+ * depth. Since these numbers are well known for a set of positions, they are
+ * the standard way of verifying move generators. A pass counts as a move,
+ * a finished game has no moves.
+ *
+ * Both move generators are covered: the move based one (Moves, MakeMove and
+ * UnmakeMove) and the board based one (NextBoards).
+ */
+
+/* Node count below a single root move */
+type PerftDivision struct {
+	Move  AtaxxMove
+	Nodes uint64
+}
+
+/* Count leaf nodes using the move generator */
+func Perft(game MoveGameboard, maximizingPlayer bool, depth int) uint64 {
+	if depth <= 0 {
+		return 1
+	}
+
+	moves := game.Moves(maximizingPlayer)
+
+	/* Bulk counting, no need to perform the last moves */
+	if depth == 1 {
+		return uint64(len(moves))
+	}
+
+	var nodes uint64
+	for _, move := range moves {
+		captured := game.MakeMove(move, maximizingPlayer)
+		nodes += Perft(game, !maximizingPlayer, depth-1)
+		game.UnmakeMove(move, maximizingPlayer, captured)
+	}
+
+	return nodes
+}
+
+/* Count leaf nodes using the board generator */
+func PerftBoards(game MinimaxableGameboard, maximizingPlayer bool, depth int) uint64 {
+	if depth <= 0 {
+		return 1
+	}
+
+	boards := game.NextBoards(maximizingPlayer)
+	if depth == 1 {
+		return uint64(len(boards))
+	}
+
+	var nodes uint64
+	for _, board := range boards {
+		nodes += PerftBoards(board, !maximizingPlayer, depth-1)
+	}
+
+	return nodes
+}
+
+/* Perft split up by root move, for finding the move generation bug once
+ * the total count turns out to be wrong.
+ */
+func Divide(game MoveGameboard, maximizingPlayer bool, depth int) []PerftDivision {
+	divisions := make([]PerftDivision, 0)
+	if depth <= 0 {
+		return divisions
+	}
+
+	for _, move := range game.Moves(maximizingPlayer) {
+		captured := game.MakeMove(move, maximizingPlayer)
+		divisions = append(divisions, PerftDivision{move, Perft(game, !maximizingPlayer, depth-1)})
+		game.UnmakeMove(move, maximizingPlayer, captured)
+	}
+
+	return divisions
+}
+
+/* Run the perft subcommand
+ *
+ * perft [-fen FEN] [-board bit|grid] [-boards] [-divide] depth
+ */
+func RunPerft(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("perft", flag.ContinueOnError)
+	fen := flags.String("fen", StartFEN, "position to count from")
+	boardType := flags.String("board", "bit", "board implementation: bit or grid")
+	useBoards := flags.Bool("boards", false, "use NextBoards instead of the move generator")
+	divide := flags.Bool("divide", false, "print node counts per root move")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("perft: expected a single depth argument")
+	}
+	depth, err := strconv.Atoi(flags.Arg(0))
+	if err != nil || depth < 0 {
+		return fmt.Errorf("perft: invalid depth %q", flags.Arg(0))
+	}
+
+	board, state, err := ParseBoardFEN(*fen)
+	if err != nil {
+		return err
+	}
+
+	var game MoveGameboard
+	switch *boardType {
+	case "bit":
+		bitboard := board.ToBitboard()
+		game = &bitboard
+	case "grid":
+		game = board
+	default:
+		return fmt.Errorf("perft: unknown board type %q", *boardType)
+	}
+
+	if *divide {
+		var total uint64
+		for _, division := range Divide(game, state.MaximizingPlayer, depth) {
+			fmt.Fprintf(out, "%s %d\n", division.Move, division.Nodes)
+			total += division.Nodes
+		}
+		fmt.Fprintf(out, "total %d\n", total)
+		return nil
+	}
+
+	for d := 1; d <= depth; d++ {
+		start := time.Now()
+		var nodes uint64
+		if *useBoards {
+			nodes = PerftBoards(game, state.MaximizingPlayer, d)
+		} else {
+			nodes = Perft(game, state.MaximizingPlayer, d)
+		}
+		elapsed := time.Since(start)
+
+		nps := uint64(0)
+		if elapsed > 0 {
+			nps = uint64(float64(nodes) / elapsed.Seconds())
+		}
+		fmt.Fprintf(out, "depth %d nodes %d time %d nps %d\n", d, nodes, elapsed.Milliseconds(), nps)
+	}
+
+	return nil
+}
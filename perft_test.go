@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+)
+
+/* Published perft results, nodes[i] being the count for depth i+1 */
+var perftPositions = []struct {
+	fen   string
+	nodes []uint64
+}{
+	{"x5o/7/7/7/7/7/o5x x 0 1", []uint64{16, 256, 6460, 155888, 4752668}},
+	{"x5o/7/7/7/7/7/o5x o 0 1", []uint64{16, 256, 6460, 155888}},
+	{"7/7/7/7/ooooooo/ooooooo/xxxxxxx x 0 1", []uint64{1, 75, 249, 14270, 452980}},
+	{"7/7/7/7/ooooooo/ooooooo/xxxxxxx o 0 1", []uint64{75, 249, 14270, 452980}},
+	{"7/7/7/7/xxxxxxx/xxxxxxx/ooooooo x 0 1", []uint64{75, 249, 14270, 452980}},
+	{"7/7/7/7/xxxxxxx/xxxxxxx/ooooooo o 0 1", []uint64{1, 75, 249, 14270, 452980}},
+	{"x5o/7/2-1-2/7/2-1-2/7/o5x x 0 1", []uint64{14, 196, 4184, 86528, 2266352}},
+	{"x5o/7/2-1-2/3-3/2-1-2/7/o5x x 0 1", []uint64{14, 196, 4100, 83104}},
+	{"x5o/7/3-3/2-1-2/3-3/7/o5x x 0 1", []uint64{16, 256, 5948, 133264}},
+	{"7/7/7/7/-------/-------/x5o x 0 1", []uint64{2, 4, 13, 30, 73, 174}},
+}
+
+func TestPerft(t *testing.T) {
+	for _, position := range perftPositions {
+		board, state, err := ParseBoardFEN(position.fen)
+		if err != nil {
+			t.Fatalf("%s: %v", position.fen, err)
+		}
+		bitboard := board.ToBitboard()
+		original := *board
+
+		for i, expected := range position.nodes {
+			depth := i + 1
+			if testing.Short() && expected > 200000 {
+				continue
+			}
+
+			counts := map[string]uint64{
+				"grid moves":  Perft(board, state.MaximizingPlayer, depth),
+				"bit moves":   Perft(&bitboard, state.MaximizingPlayer, depth),
+				"grid boards": PerftBoards(board, state.MaximizingPlayer, depth),
+				"bit boards":  PerftBoards(&bitboard, state.MaximizingPlayer, depth),
+			}
+			for generator, nodes := range counts {
+				if nodes != expected {
+					t.Errorf("%s depth %d (%s): got %d nodes, expected %d", position.fen, depth, generator, nodes, expected)
+				}
+			}
+		}
+
+		/* MakeMove/UnmakeMove should leave the boards untouched */
+		if *board != original || bitboard != original.ToBitboard() {
+			t.Errorf("%s: board changed by perft", position.fen)
+		}
+	}
+}
+
+func TestDivide(t *testing.T) {
+	board, state, _ := ParseBitboardFEN(StartFEN)
+
+	var total uint64
+	for _, division := range Divide(board, state.MaximizingPlayer, 3) {
+		total += division.Nodes
+	}
+	if expected := Perft(board, state.MaximizingPlayer, 3); total != expected {
+		t.Errorf("divide total %d, perft %d", total, expected)
+	}
+}
+
+/* Every generated move should survive a round trip through notation */
+func TestMoveNotation(t *testing.T) {
+	board, state, _ := ParseBitboardFEN("x5o/7/2x4/3o3/7/7/o5x o 0 1")
+
+	for _, move := range board.Moves(state.MaximizingPlayer) {
+		parsed, err := ParseLegalMove(board, state.MaximizingPlayer, move.String())
+		if err != nil || parsed != move {
+			t.Errorf("%v: parsed as %v, %v", move, parsed, err)
+		}
+	}
+}
@@ -0,0 +1,467 @@
+/* Game records in a PGN-like text format */
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* Games are recorded in the format chess engines use (PGN), with Ataxx
+ * moves and FENs:
+ *
+ *  [Event "Self-play"]
+ *  [Site "?"]
+ *  [Date "2024.05.01"]
+ *  [Round "-"]
+ *  [White "go-ataxx"]
+ *  [Black "go-ataxx"]
+ *  [Result "0-1"]
+ *  [FEN "x5o/7/2-1-2/7/2-1-2/7/o5x x 0 1"]
+ *
+ *  1. f2 {+1.00/3} a2 {-0.02/3} 2. e3 b3 ... 0-1
+ *
+ * Black is player X, who moves first from the standard starting position,
+ * White is player O, as in UAI. The FEN tag is only present for games not
+ * starting from the standard position. Comments in braces follow the move
+ * they describe; engine moves are commented with their score in pieces from
+ * X's point of view and the search depth. Any number of games may follow
+ * each other in a single file.
+ *
+ * When reading, semicolon comments, numeric annotations ($1) and variations
+ * in parentheses are skipped, and all moves are checked for legality.
+ */
+
+/* A tag pair, such as Event or FEN */
+type GameTag struct {
+	Name  string
+	Value string
+}
+
+/* A move along with its comment, if any */
+type RecordedMove struct {
+	Move    AtaxxMove
+	Comment string
+}
+
+/* A complete game record.
+ *
+ * The result is kept apart from the tags, as it also terminates the move
+ * list. It is written as Result tag after the player tags.
+ */
+type GameRecord struct {
+	Tags   []GameTag
+	Moves  []RecordedMove
+	Result GameResult
+}
+
+/* Tags every record starts with, in this order */
+var recordRosterTags = []string{"Event", "Site", "Date", "Round", "White", "Black"}
+
+/* Record a game, its moves without comments. All roster tags are set to
+ * unknown apart from the date, which is today.
+ */
+func NewGameRecord(game *AtaxxGame) *GameRecord {
+	return newGameRecord(game.StartFEN, game.Moves, game.Result())
+}
+
+/* Record a game given by its moves from a position, see NewGameRecord */
+func newGameRecord(fen string, moves []AtaxxMove, result GameResult) *GameRecord {
+	record := &GameRecord{Result: result}
+	for _, name := range recordRosterTags {
+		record.SetTag(name, "?")
+	}
+	record.SetTag("Date", time.Now().Format("2006.01.02"))
+	record.SetTag("Round", "-")
+	if fen != StartFEN {
+		record.SetTag("FEN", fen)
+	}
+
+	record.Moves = make([]RecordedMove, len(moves))
+	for i, move := range moves {
+		record.Moves[i].Move = move
+	}
+
+	return record
+}
+
+/* Value of a tag, empty if not present */
+func (record *GameRecord) Tag(name string) string {
+	for _, tag := range record.Tags {
+		if tag.Name == name {
+			return tag.Value
+		}
+	}
+
+	return ""
+}
+
+/* Set a tag, replacing its value if already present */
+func (record *GameRecord) SetTag(name, value string) {
+	for i := range record.Tags {
+		if record.Tags[i].Name == name {
+			record.Tags[i].Value = value
+			return
+		}
+	}
+	record.Tags = append(record.Tags, GameTag{name, value})
+}
+
+/* Position the game started from */
+func (record *GameRecord) StartFEN() string {
+	if fen := record.Tag("FEN"); fen != "" {
+		return fen
+	}
+	return StartFEN
+}
+
+/* Replay the recorded moves */
+func (record *GameRecord) Game() (*AtaxxGame, error) {
+	game, err := NewAtaxxGame(record.StartFEN())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, move := range record.Moves {
+		if err := game.Play(move.Move); err != nil {
+			return game, fmt.Errorf("move %d %v: %w", game.FullmoveNumber, move.Move, err)
+		}
+	}
+
+	return game, nil
+}
+
+/* Comment describing an engine move: score from X's point of view, see
+ * ScoreString, and search depth, or "book" for book moves.
+ */
+func SearchComment(result SearchResult) string {
+	if result.Book {
+		return "book"
+	}
+	return fmt.Sprintf("%s/%d", ScoreString(result.Score), result.Depth)
+}
+
+/* Maximum length of move text lines */
+const recordLineLength = 79
+
+/* Write the record, followed by an empty line */
+func (record *GameRecord) Write(out io.Writer) error {
+	var text strings.Builder
+
+	/* Tags, with the result following the roster */
+	result := GameTag{"Result", record.Result.String()}
+	written := false
+	for _, tag := range record.Tags {
+		if tag.Name == "Result" {
+			continue
+		}
+		if !written && !isRosterTag(tag.Name) {
+			writeTag(&text, result)
+			written = true
+		}
+		writeTag(&text, tag)
+	}
+	if !written {
+		writeTag(&text, result)
+	}
+	text.WriteString("\n")
+
+	/* Move text, wrapped at word boundaries */
+	game, err := NewAtaxxGame(record.StartFEN())
+	if err != nil {
+		return err
+	}
+	number, maximizingPlayer := game.FullmoveNumber, game.MaximizingPlayer
+
+	line := 0
+	word := func(word string) {
+		if line > 0 && line+1+len(word) > recordLineLength {
+			text.WriteString("\n")
+			line = 0
+		}
+		if line > 0 {
+			text.WriteString(" ")
+			line++
+		}
+		text.WriteString(word)
+		line += len(word)
+	}
+
+	needNumber := true
+	for _, move := range record.Moves {
+		if maximizingPlayer {
+			word(strconv.Itoa(number) + ".")
+		} else if needNumber {
+			word(strconv.Itoa(number) + "...")
+		}
+		word(move.Move.String())
+		needNumber = false
+
+		if strings.TrimSpace(move.Comment) != "" {
+			/* Braces cannot be escaped within comments */
+			comment := strings.NewReplacer("{", "(", "}", ")").Replace(move.Comment)
+			for i, part := range strings.Fields(comment) {
+				if i == 0 {
+					part = "{" + part
+				}
+				word(part)
+			}
+			text.WriteString("}")
+			line++
+			needNumber = true
+		}
+
+		if !maximizingPlayer {
+			number++
+		}
+		maximizingPlayer = !maximizingPlayer
+	}
+	word(record.Result.String())
+	text.WriteString("\n\n")
+
+	_, err = io.WriteString(out, text.String())
+	return err
+}
+
+/* Whether a tag belongs to the roster, which precedes the result */
+func isRosterTag(name string) bool {
+	for _, roster := range recordRosterTags {
+		if name == roster {
+			return true
+		}
+	}
+	return false
+}
+
+/* Write a single tag pair line */
+func writeTag(text *strings.Builder, tag GameTag) {
+	value := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(tag.Value)
+	fmt.Fprintf(text, "[%s \"%s\"]\n", tag.Name, value)
+}
+
+/* Read all games from the input */
+func ReadGameRecords(in io.Reader) ([]*GameRecord, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := recordParser{text: string(data), line: 1}
+	records := make([]*GameRecord, 0)
+	for {
+		record, err := parser.game()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, fmt.Errorf("pgn: line %d: %v", parser.line, err)
+		}
+
+		if _, err := record.Game(); err != nil {
+			return records, fmt.Errorf("pgn: game %d: %v", len(records)+1, err)
+		}
+		records = append(records, record)
+	}
+}
+
+/* State of reading game records */
+type recordParser struct {
+	text string
+	pos  int
+	line int
+}
+
+/* Skip whitespace, escaped lines and semicolon comments */
+func (parser *recordParser) skipSpace() {
+	atLineStart := parser.pos == 0
+	for parser.pos < len(parser.text) {
+		c := parser.text[parser.pos]
+		switch {
+		case c == '\n':
+			parser.line++
+			atLineStart = true
+			parser.pos++
+			continue
+		case c == ' ' || c == '\t' || c == '\r':
+			atLineStart = false
+			parser.pos++
+			continue
+		case c == ';' || (c == '%' && atLineStart):
+			for parser.pos < len(parser.text) && parser.text[parser.pos] != '\n' {
+				parser.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+/* Read up to and including the given delimiter, returning the text before */
+func (parser *recordParser) until(delimiter byte) (string, error) {
+	start := parser.pos
+	for parser.pos < len(parser.text) && parser.text[parser.pos] != delimiter {
+		if parser.text[parser.pos] == '\n' {
+			parser.line++
+		}
+		parser.pos++
+	}
+	if parser.pos >= len(parser.text) {
+		return "", fmt.Errorf("missing %q", delimiter)
+	}
+	parser.pos++
+
+	return parser.text[start : parser.pos-1], nil
+}
+
+/* Read a tag pair, the opening bracket already consumed */
+func (parser *recordParser) tag() (GameTag, error) {
+	parser.skipSpace()
+	start := parser.pos
+	for parser.pos < len(parser.text) && parser.text[parser.pos] != ' ' && parser.text[parser.pos] != '"' {
+		parser.pos++
+	}
+	name := parser.text[start:parser.pos]
+
+	parser.skipSpace()
+	if parser.pos >= len(parser.text) || parser.text[parser.pos] != '"' {
+		return GameTag{}, fmt.Errorf("tag %s without value", name)
+	}
+	parser.pos++
+
+	var value strings.Builder
+	for {
+		if parser.pos >= len(parser.text) || parser.text[parser.pos] == '\n' {
+			return GameTag{}, fmt.Errorf("unterminated value of tag %s", name)
+		}
+		c := parser.text[parser.pos]
+		parser.pos++
+		if c == '"' {
+			break
+		}
+		if c == '\\' && parser.pos < len(parser.text) {
+			c = parser.text[parser.pos]
+			parser.pos++
+		}
+		value.WriteByte(c)
+	}
+
+	parser.skipSpace()
+	if _, err := parser.until(']'); err != nil {
+		return GameTag{}, err
+	}
+
+	return GameTag{name, value.String()}, nil
+}
+
+/* Read the next word of move text */
+func (parser *recordParser) word() string {
+	start := parser.pos
+	for parser.pos < len(parser.text) && !strings.ContainsRune(" \t\r\n{}();[", rune(parser.text[parser.pos])) {
+		parser.pos++
+	}
+	return parser.text[start:parser.pos]
+}
+
+/* Read a single game, io.EOF if there is none left */
+func (parser *recordParser) game() (*GameRecord, error) {
+	record := &GameRecord{}
+
+	parser.skipSpace()
+	if parser.pos >= len(parser.text) {
+		return nil, io.EOF
+	}
+
+	/* Tag pairs */
+	for parser.pos < len(parser.text) && parser.text[parser.pos] == '[' {
+		parser.pos++
+		tag, err := parser.tag()
+		if err != nil {
+			return nil, err
+		}
+		if tag.Name == "Result" {
+			if err := record.Result.UnmarshalText([]byte(tag.Value)); err != nil {
+				return nil, err
+			}
+		} else {
+			record.SetTag(tag.Name, tag.Value)
+		}
+		parser.skipSpace()
+	}
+
+	/* Move text, up to the result */
+	for {
+		parser.skipSpace()
+		if parser.pos >= len(parser.text) {
+			return nil, errors.New("move text without result")
+		}
+
+		switch parser.text[parser.pos] {
+		case '{':
+			parser.pos++
+			comment, err := parser.until('}')
+			if err != nil {
+				return nil, err
+			}
+			if len(record.Moves) > 0 {
+				last := &record.Moves[len(record.Moves)-1]
+				last.Comment = strings.TrimSpace(last.Comment + " " + strings.Join(strings.Fields(comment), " "))
+			}
+			continue
+
+		case '(':
+			/* Skip variations, which may be nested */
+			for depth := 0; ; {
+				c := parser.text[parser.pos]
+				if c == '(' {
+					depth++
+				} else if c == ')' {
+					depth--
+				} else if c == '\n' {
+					parser.line++
+				}
+				parser.pos++
+				if depth == 0 {
+					break
+				}
+				if parser.pos >= len(parser.text) {
+					return nil, errors.New("unterminated variation")
+				}
+			}
+			continue
+
+		case '[':
+			return nil, errors.New("tag pair within move text")
+		}
+
+		word := parser.word()
+		if word == "" {
+			return nil, fmt.Errorf("unexpected %q", parser.text[parser.pos])
+		}
+
+		var result GameResult
+		if err := result.UnmarshalText([]byte(word)); err == nil {
+			if result != record.Result && record.Result != ResultNone {
+				return nil, fmt.Errorf("result %v does not match Result tag %v", result, record.Result)
+			}
+			record.Result = result
+			return record, nil
+		}
+
+		/* Move numbers may be written attached to the move */
+		if digits := strings.TrimLeft(word, "0123456789"); strings.HasPrefix(digits, ".") {
+			word = strings.TrimLeft(digits, ".")
+		}
+		if word == "" || strings.HasPrefix(word, "$") {
+			continue
+		}
+
+		move, err := ParseMove(word)
+		if err != nil {
+			return nil, err
+		}
+		record.Moves = append(record.Moves, RecordedMove{Move: move})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/* Writing and reading a record must give the same record back, apart from
+ * empty comments, which are left out, and braces within comments.
+ */
+func TestGameRecordRoundTrip(t *testing.T) {
+	/* O is walled in and has to pass */
+	game, err := NewAtaxxGame("oxx4/xxx4/xxx4/7/7/7/7 x 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, notation := range []string{"d7", "0000", "d6", "0000", "e7"} {
+		if err := game.PlayNotation(notation); err != nil {
+			t.Fatalf("%s: %v", notation, err)
+		}
+	}
+
+	comments := []string{"book", "", "+1.00/3 {best}", "  ", "-0.50/12"}
+	expected := []string{"book", "", "+1.00/3 (best)", "", "-0.50/12"}
+
+	for _, result := range []GameResult{ResultNone, ResultXWins, ResultOWins, ResultDraw} {
+		record := NewGameRecord(game)
+		record.SetTag("Event", `Test "quoted" \ event`)
+		record.SetTag("Black", "go-ataxx")
+		record.SetTag("Termination", "adjudication")
+		record.Result = result
+		for i, comment := range comments {
+			record.Moves[i].Comment = comment
+		}
+
+		var text strings.Builder
+		if err := record.Write(&text); err != nil {
+			t.Fatal(err)
+		}
+		if opening, closing := strings.Count(text.String(), "{"), strings.Count(text.String(), "}"); opening != 3 || closing != 3 {
+			t.Errorf("%v: %d opening and %d closing braces, expected 3:\n%s", result, opening, closing, text.String())
+		}
+
+		records, err := ReadGameRecords(strings.NewReader(text.String()))
+		if err != nil || len(records) != 1 {
+			t.Fatalf("%v: got %d records, %v:\n%s", result, len(records), err, text.String())
+		}
+		read := records[0]
+
+		if read.Result != result {
+			t.Errorf("result %v, expected %v", read.Result, result)
+		}
+		if !reflect.DeepEqual(read.Tags, record.Tags) {
+			t.Errorf("%v: tags %v, expected %v", result, read.Tags, record.Tags)
+		}
+		if len(read.Moves) != len(record.Moves) {
+			t.Fatalf("%v: %d moves, expected %d", result, len(read.Moves), len(record.Moves))
+		}
+		for i, move := range read.Moves {
+			if move.Move != record.Moves[i].Move || move.Comment != expected[i] {
+				t.Errorf("%v: move %d %v {%s}, expected %v {%s}", result, i, move.Move, move.Comment, record.Moves[i].Move, expected[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,456 @@
+/* Engines taking part in matches: built-in or external UAI programs */
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* An engine configuration is given as comma separated key=value pairs:
+ *
+ *  name=NAME         name used in reports, defaults to the spec itself
+ *  depth=N           search N plies per move
+ *  movetime=MS       think MS milliseconds per move
+ *  tc=BASE+INC       clock of BASE seconds, INC seconds added per move
+ *  eval=FILE         evaluation weights, see LoadEvalWeights
+ *  book=FILE         opening book, see OpeningBook
+ *  cmd=PROGRAM ARGS  external UAI engine instead of the built-in one
+ *  algo=ALGORITHM    alphabeta, the default, or mcts, see MCTS
+ *  iterations=N      MCTS iterations per move
+ *  policy=POLICY     MCTS playout policy, random or greedy
+ *  c=C               MCTS exploration constant
+ *  ordering=on|off   move ordering, see SearchFeatures
+ *  pvs=on|off        principal variation search
+ *  aspiration=on|off aspiration windows
+ *  lmr=on|off        late move reductions
+ *
+ * For example "depth=4", "tc=10+0.1,eval=tuned.json", "cmd=./ataxx uai" or
+ * "algo=mcts,iterations=5000,policy=greedy". Without any limit the engine
+ * thinks 100ms per move. MCTS does not take a depth limit. Search features
+ * are all on by default; external engines are told to switch off the ones
+ * switched off here.
+ */
+type EngineConfig struct {
+	Name      string
+	Depth     int
+	MoveTime  time.Duration
+	Time      time.Duration
+	Increment time.Duration
+	EvalFile  string
+	BookFile  string
+	Command   []string
+	Features  SearchFeatures
+
+	/* Monte Carlo tree search settings */
+	Algorithm   string
+	Iterations  int
+	Policy      PlayoutPolicy
+	Exploration float64
+}
+
+/* Thinking time of engines without any limit */
+const defaultMatchMoveTime = 100 * time.Millisecond
+
+/* Parse an engine configuration */
+func ParseEngineConfig(spec string) (EngineConfig, error) {
+	config := EngineConfig{Name: spec, Features: DefaultSearchFeatures, Algorithm: "alphabeta", Exploration: DefaultExploration}
+
+	for _, option := range strings.Split(spec, ",") {
+		key, value, found := strings.Cut(option, "=")
+		if !found || value == "" {
+			return config, fmt.Errorf("engine: expected key=value in %q", option)
+		}
+
+		var err error
+		switch key {
+		case "name":
+			config.Name = value
+		case "depth":
+			config.Depth, err = strconv.Atoi(value)
+			if err == nil && (config.Depth < 1 || config.Depth > MaxSearchDepth) {
+				err = errors.New("out of range")
+			}
+		case "movetime":
+			var ms int
+			ms, err = strconv.Atoi(value)
+			config.MoveTime = time.Duration(ms) * time.Millisecond
+		case "tc":
+			base, increment, _ := strings.Cut(value, "+")
+			config.Time, err = parseSeconds(base)
+			if err == nil && increment != "" {
+				config.Increment, err = parseSeconds(increment)
+			}
+		case "eval":
+			config.EvalFile = value
+		case "book":
+			config.BookFile = value
+		case "cmd":
+			config.Command = strings.Fields(value)
+		case "algo":
+			config.Algorithm = value
+			if value != "alphabeta" && value != "mcts" {
+				err = errors.New("unknown algorithm")
+			}
+		case "iterations":
+			config.Iterations, err = strconv.Atoi(value)
+			if err == nil && config.Iterations < 1 {
+				err = errors.New("out of range")
+			}
+		case "policy":
+			config.Policy, err = ParsePlayoutPolicy(value)
+		case "ordering":
+			config.Features.OrderMoves, err = parseSwitch(value)
+		case "pvs":
+			config.Features.PVS, err = parseSwitch(value)
+		case "aspiration":
+			config.Features.Aspiration, err = parseSwitch(value)
+		case "lmr":
+			config.Features.LMR, err = parseSwitch(value)
+		case "c":
+			config.Exploration, err = strconv.ParseFloat(value, 64)
+			if err == nil && config.Exploration < 0 {
+				err = errors.New("out of range")
+			}
+		default:
+			return config, fmt.Errorf("engine: unknown option %q", key)
+		}
+		if err != nil {
+			return config, fmt.Errorf("engine: invalid %s %q: %v", key, value, err)
+		}
+	}
+
+	if config.Algorithm == "mcts" && config.Depth > 0 {
+		return config, errors.New("engine: mcts does not take a depth limit")
+	}
+	if config.Depth == 0 && config.MoveTime == 0 && config.Time == 0 && config.Iterations == 0 {
+		config.MoveTime = defaultMatchMoveTime
+	}
+
+	return config, nil
+}
+
+/* Parse a duration given in (fractional) seconds */
+func parseSeconds(text string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(text, 64)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("invalid number of seconds %q", text)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+/* Parse a switch, on or off */
+func parseSwitch(text string) (bool, error) {
+	switch text {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+
+	return false, errors.New("expected on or off")
+}
+
+/* Limits for the next move, given the clocks of both players */
+func (config *EngineConfig) limits(clocks [2]time.Duration, increments [2]time.Duration) uaiLimits {
+	limits := uaiLimits{depth: config.Depth, moveTime: config.MoveTime}
+	if config.Time > 0 {
+		limits.time, limits.inc = clocks, increments
+	}
+
+	return limits
+}
+
+/* An engine playing one game at a time */
+type MatchPlayer interface {
+	/* Prepare for a new game */
+	NewGame() error
+
+	/* Choose a move for the player to move in the game.
+	 *
+	 * Along with the move the time spent choosing it is returned, which is
+	 * taken off the clock of the player. Setting up the search is not
+	 * counted.
+	 */
+	Move(game *AtaxxGame, limits uaiLimits) (AtaxxMove, time.Duration, error)
+
+	/* Release all resources */
+	Close() error
+}
+
+/* Start a player for this configuration */
+func (config *EngineConfig) Start() (MatchPlayer, error) {
+	if len(config.Command) > 0 {
+		player, err := startUAIPlayer(config)
+		if err != nil {
+			return nil, err
+		}
+		return player, nil
+	}
+	if config.Algorithm == "mcts" {
+		mcts := NewMCTS()
+		mcts.Iterations, mcts.Policy, mcts.Exploration = config.Iterations, config.Policy, config.Exploration
+		return &mctsPlayer{mcts}, nil
+	}
+
+	player := &enginePlayer{weights: engineEvalWeights, features: config.Features, transposition: NewBitTranspositionTable(1 << 18)}
+	if config.EvalFile != "" {
+		weights, err := LoadEvalWeights(config.EvalFile)
+		if err != nil {
+			return nil, err
+		}
+		player.weights = weights
+	}
+	if config.BookFile != "" {
+		book, err := LoadOpeningBook(config.BookFile)
+		if err != nil {
+			return nil, err
+		}
+		player.book = book
+	}
+
+	return player, nil
+}
+
+/* The built-in engine */
+type enginePlayer struct {
+	weights       EvalWeights
+	book          *OpeningBook
+	features      SearchFeatures
+	transposition *AtaxxBitTranspositionTable
+}
+
+func (player *enginePlayer) NewGame() error {
+	player.transposition.Clear()
+	return nil
+}
+
+func (player *enginePlayer) Move(game *AtaxxGame, limits uaiLimits) (AtaxxMove, time.Duration, error) {
+	board := game.Board
+	player.transposition.NewSearch()
+	searcher := NewSearcher(player.transposition)
+	searcher.Weights = &player.weights
+	searcher.Book = player.book
+	searcher.SearchFeatures = player.features
+
+	start := time.Now()
+	result := searcher.IterativeDeepening(context.Background(), &board, game.MaximizingPlayer, limits.searchLimits(game.MaximizingPlayer))
+	return result.Move, time.Since(start), nil
+}
+
+func (player *enginePlayer) Close() error {
+	return nil
+}
+
+/* The built-in engine using Monte Carlo tree search */
+type mctsPlayer struct {
+	mcts *MCTS
+}
+
+func (player *mctsPlayer) NewGame() error {
+	player.mcts.Reset()
+	return nil
+}
+
+func (player *mctsPlayer) Move(game *AtaxxGame, limits uaiLimits) (AtaxxMove, time.Duration, error) {
+	board := game.Board
+	start := time.Now()
+	result := player.mcts.Search(context.Background(), &board, game.MaximizingPlayer, limits.searchLimits(game.MaximizingPlayer))
+	return result.Move, time.Since(start), nil
+}
+
+func (player *mctsPlayer) Close() error {
+	return nil
+}
+
+/* Extra time granted to external engines before they are considered hung,
+ * on top of their own time limit.
+ */
+const uaiResponseMargin = 5 * time.Second
+
+/* Time allowed for answering a depth limited search */
+const uaiDepthTimeout = time.Minute
+
+/* An external engine speaking UAI over stdin/stdout */
+type uaiPlayer struct {
+	name  string
+	cmd   *exec.Cmd
+	in    io.WriteCloser
+	lines chan string
+}
+
+/* Launch an external engine and wait until it is ready */
+func startUAIPlayer(config *EngineConfig) (*uaiPlayer, error) {
+	cmd := exec.Command(config.Command[0], config.Command[1:]...)
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("engine %s: %v", config.Name, err)
+	}
+
+	player := &uaiPlayer{config.Name, cmd, in, make(chan string)}
+	go func() {
+		scanner := bufio.NewScanner(out)
+		for scanner.Scan() {
+			player.lines <- scanner.Text()
+		}
+		close(player.lines)
+	}()
+
+	player.send("uai")
+	if _, err := player.expect("uaiok", uaiResponseMargin); err != nil {
+		player.Close()
+		return nil, err
+	}
+	if config.EvalFile != "" {
+		player.send("setoption name EvalFile value " + config.EvalFile)
+	}
+	if config.BookFile != "" {
+		player.send("setoption name BookFile value " + config.BookFile)
+	}
+	for _, feature := range uaiFeatureOptions(&config.Features) {
+		if !*feature.enabled {
+			player.send("setoption name " + feature.name + " value false")
+		}
+	}
+	if err := player.ready(); err != nil {
+		player.Close()
+		return nil, err
+	}
+
+	return player, nil
+}
+
+/* Write a single command to the engine */
+func (player *uaiPlayer) send(line string) {
+	io.WriteString(player.in, line+"\n")
+}
+
+/* Read lines until one starts with the given token, returning that line */
+func (player *uaiPlayer) expect(token string, timeout time.Duration) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case line, ok := <-player.lines:
+			if !ok {
+				return "", fmt.Errorf("engine %s: exited while waiting for %s", player.name, token)
+			}
+			if fields := strings.Fields(line); len(fields) > 0 && fields[0] == token {
+				return line, nil
+			}
+		case <-timer.C:
+			return "", fmt.Errorf("engine %s: no %s within %v", player.name, token, timeout)
+		}
+	}
+}
+
+/* Synchronize with the engine */
+func (player *uaiPlayer) ready() error {
+	player.send("isready")
+	_, err := player.expect("readyok", uaiResponseMargin)
+	return err
+}
+
+func (player *uaiPlayer) NewGame() error {
+	player.send("uainewgame")
+	return player.ready()
+}
+
+func (player *uaiPlayer) Move(game *AtaxxGame, limits uaiLimits) (AtaxxMove, time.Duration, error) {
+	position := "position fen " + game.StartFEN
+	if len(game.Moves) > 0 {
+		moves := make([]string, len(game.Moves))
+		for i, move := range game.Moves {
+			moves[i] = move.String()
+		}
+		position += " moves " + strings.Join(moves, " ")
+	}
+	player.send(position)
+	start := time.Now()
+	player.send("go " + limits.String())
+
+	/* Give the engine its own limit and some slack to answer */
+	timeout := uaiDepthTimeout
+	if limits.searchLimits(game.MaximizingPlayer).Budget() > 0 {
+		timeout = limits.time[boolIndex(game.MaximizingPlayer)] + limits.moveTime + uaiResponseMargin
+	}
+
+	line, err := player.expect("bestmove", timeout)
+	elapsed := time.Since(start)
+	if err != nil {
+		return PassMove, elapsed, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return PassMove, elapsed, fmt.Errorf("engine %s: bestmove without move", player.name)
+	}
+
+	move, err := ParseMove(fields[1])
+	return move, elapsed, err
+}
+
+func (player *uaiPlayer) Close() error {
+	player.send("quit")
+	player.in.Close()
+	go func() {
+		for range player.lines {
+		}
+	}()
+
+	/* Give the engine a moment to exit on its own */
+	exited := make(chan error, 1)
+	go func() { exited <- player.cmd.Wait() }()
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(time.Second):
+		player.cmd.Process.Kill()
+		return <-exited
+	}
+}
+
+/* Format limits as arguments of the UAI "go" command */
+func (limits uaiLimits) String() string {
+	args := make([]string, 0)
+	if limits.depth > 0 {
+		args = append(args, "depth", strconv.Itoa(limits.depth))
+	}
+	if limits.moveTime > 0 {
+		args = append(args, "movetime", strconv.FormatInt(limits.moveTime.Milliseconds(), 10))
+	}
+	if limits.time[1] > 0 || limits.time[0] > 0 {
+		args = append(args,
+			"wtime", strconv.FormatInt(limits.time[0].Milliseconds(), 10),
+			"btime", strconv.FormatInt(limits.time[1].Milliseconds(), 10),
+			"winc", strconv.FormatInt(limits.inc[0].Milliseconds(), 10),
+			"binc", strconv.FormatInt(limits.inc[1].Milliseconds(), 10))
+	}
+	if limits.infinite {
+		args = append(args, "infinite")
+	}
+
+	return strings.Join(args, " ")
+}
+
+/* Index of a player in per-side arrays such as uaiLimits.time */
+func boolIndex(maximizingPlayer bool) int {
+	if maximizingPlayer {
+		return 1
+	}
+	return 0
+}
@@ -2,7 +2,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type MinimaxableGameboard interface {
@@ -32,44 +36,599 @@ type MinimaxableGameboard interface {
 	Finished() bool
 }
 
+/* A game board that can generate and perform individual moves.
+ *
+ * Instead of producing a slice of complete boards for every position, the
+ * search asks for the moves available and performs them in place, undoing
+ * them afterwards. This way the search knows which move leads to the best
+ * result, not merely the resulting board.
+ */
+type MoveGameboard interface {
+	MinimaxableGameboard
+
+	/* Return all legal moves for the given player.
+	 *
+	 * A player that cannot move while the game is not finished has a
+	 * single pass move available. A finished game has no moves.
+	 */
+	Moves(maximizingPlayer bool) []AtaxxMove
+
+	/* Perform a move in place, returning the information needed to undo it */
+	MakeMove(move AtaxxMove, maximizingPlayer bool) SingleBitboard
+
+	/* Undo a move previously performed by MakeMove */
+	UnmakeMove(move AtaxxMove, maximizingPlayer bool, captured SingleBitboard)
+}
+
 /* Interface for abstract transposition tables.
  * Replacement strategy, etc. is left to the implementor.
  */
 type TranspositionTable interface {
-	/* Load a known board from the hash table.
-		 *
-		 * The key used to lookup the cached values is comprised of the
-		 * combination of the board state, the player to move next
-	     * and the search depth, as this influences the heuristic score:
-		 *  game: The current game state.
-		 *  maximizingPlayer: The player about to move.
-	     *  depth: Search depth remaining
-		 *
-		 * The function has three return values:
-		 *  resultBoard: The board after the player has moved.
-		 *  resultScore: Calculated score heuristic for this move.
-		 *  found: Wether or not the specified key is in the hash table.
-		 *
-		 * If the lookup is successful resultBoard and resultScore are set
-		 * to the stored values and "found" is set to true.
-		 *
-		 * In case this board/player combination is not know.
-		 * the board and score return values are undefined.
-		 * the boolean "found" value should be set to false
-	*/
-	Load(game MinimaxableGameboard, maximizingPlayer bool, depth int, alpha int, beta int) (MinimaxableGameboard, int, bool)
+	/* Load a known position from the hash table.
+	 *
+	 * The key used to lookup the cached values is the hash of the
+	 * combination of the board state and the player to move next, see
+	 * hashGameboard. Bitboards keep their key up to date while moves are
+	 * made, the search reads it once per node for both Load and Store.
+	 *
+	 * The function has two return values:
+	 *  entry: The stored best move, score, search depth and bound type.
+	 *  found: Wether or not the specified key is in the hash table.
+	 *
+	 * It is up to the search to decide wether the entry is usable, as
+	 * the stored depth may be too shallow, or the bound may not be tight
+	 * enough for the current alpha-beta window.
+	 */
+	Load(key uint64) (entry TranspositionEntry, found bool)
 
-	/* Store a board/score result to the hash table.
-		 *
-		 * The first two arguments form the key, which will also be used to look up:
-		 *  game: The current game state.
-		 *  maximizingPlayer: The player about to move.
-	     *  depth: Search depth remaining
-		 * the second two arguments form the value:
-		 *  resultBoard: The board after the player has moved.
-		 *  resultScore: Calculated score heuristic for this move.
-	*/
-	Store(game MinimaxableGameboard, maximizingPlayer bool, depth int, alpha int, beta int, resultBoard MinimaxableGameboard, resultScore int)
+	/* Store a search result to the hash table.
+	 *
+	 * The key is the same as the one used to look up the position, the
+	 * entry forms the value:
+	 *  entry: The best move, its score, the search depth and the bound type.
+	 */
+	Store(key uint64, entry TranspositionEntry)
+
+	/* Return the number of probes, hits and stores so far.
+	 *
+	 * The hit rate follows from these, see TranspositionStats.HitRate.
+	 */
+	Stats() TranspositionStats
+
+	/* Return how full the table is, in permille.
+	 *
+	 * This is reported during search, so it may be estimated from a
+	 * sample of the table.
+	 */
+	Fill() int
+}
+
+/* Deepest iteration an iterative deepening search will start */
+const MaxSearchDepth = 64
+
+/* Bound on all search scores, for the initial alpha-beta window */
+const ScoreInfinity = 1 << 20
+
+/* Limits for an iterative deepening search
+ *
+ * Depth is the maximum number of plies to search, zero meaning no limit.
+ * The time budget is either a fixed MoveTime, or derived from the remaining
+ * Time on the clock of the player to move plus its Increment.
+ * Without any time set, the search only stops at maximum depth or when
+ * stopped explicitly.
+ */
+type SearchLimits struct {
+	Depth     int
+	MoveTime  time.Duration
+	Time      time.Duration
+	Increment time.Duration
+}
+
+/* Outcome of a search
+ *
+ * Incomplete is set when the search context was cancelled (client
+ * disconnect, timeout, shutdown) before the search reached its limits. The
+ * move and score are then the best found so far.
+ *
+ * Book is set when the move was taken from the opening book without
+ * searching.
+ *
+ * Solved is set when the endgame solver decided the game: the score is then
+ * either exact, or proven to be a win or loss, see solve.
+ */
+type SearchResult struct {
+	Move       AtaxxMove
+	Score      int
+	Depth      int
+	Incomplete bool
+	Book       bool
+	Solved     bool
+
+	/* Statistics of the last completed iteration */
+	Info SearchInfo
+}
+
+/* Progress of a search, reported after every completed iteration
+ *
+ * SelDepth is the deepest ply actually reached, which may differ from the
+ * nominal Depth once parts of the tree are searched deeper or shallower.
+ * HashHits is the fraction of transposition table probes finding an entry.
+ */
+type SearchInfo struct {
+	Depth    int
+	SelDepth int
+	Score    int
+	PV       []AtaxxMove
+	Nodes    int
+	Time     time.Duration
+	NPS      int
+	HashHits float64
+}
+
+/* Enhancements of the alpha-beta search, which can be switched off to
+ * measure what they are worth, e.g. in matches against the full search.
+ */
+type SearchFeatures struct {
+	/* Order moves before searching them, see orderMoves */
+	OrderMoves bool
+
+	/* Principal variation search, see negamax */
+	PVS bool
+
+	/* Aspiration windows around the score of the previous iteration, see
+	 * iteration
+	 */
+	Aspiration bool
+
+	/* Late move reductions, see lateMoveReduction */
+	LMR bool
+}
+
+/* All enhancements switched on */
+var DefaultSearchFeatures = SearchFeatures{OrderMoves: true, PVS: true, Aspiration: true, LMR: true}
+
+/* State of a single search
+ *
+ * A search is stopped by cancelling its context, or by running out of time.
+ * The running iteration is then abandoned and the result of the last
+ * completed iteration is used.
+ */
+type Searcher struct {
+	transposition TranspositionTable
+
+	/* Evaluation used at the leaves, see EvalWeights */
+	Weights *EvalWeights
+
+	/* Moves played without searching while in the book, may be nil */
+	Book *OpeningBook
+
+	/* Positions with at most this many empty cells are searched by the
+	 * endgame solver, see solve.
+	 */
+	SolveEmpty int
+
+	/* Number of threads searching in parallel, see startHelpers */
+	Threads int
+
+	/* Enhancements of alpha-beta in use */
+	SearchFeatures
+
+	/* Called after every completed iteration, may be nil */
+	OnInfo func(info SearchInfo)
+
+	/* Time control and cancellation */
+	done          <-chan struct{}
+	deadline      time.Time
+	interruptible bool
+	stopped       bool
+
+	/* Wether the solver evaluated a position heuristically */
+	horizon bool
+
+	/* Killer moves and history for move ordering, created on first use */
+	history *moveHistory
+
+	/* Scores of the last completed iterations of even and odd depth, see
+	 * aspirationSearch
+	 */
+	previousScores [2]int
+	hasPrevious    [2]bool
+
+	/* Statistics */
+	nodes     int
+	selDepth  int
+	hashProbe int
+	hashHits  int
+
+	/* Helpers of a parallel search, and the node count a helper shares
+	 * with the main search.
+	 */
+	helpers   []*Searcher
+	published int64
+
+	/* Triangular principal variation table, pvTable[ply] holds the best
+	 * line found from ply onwards in the current node at that ply.
+	 */
+	ply      int
+	pvTable  [MaxSearchDepth + 1][MaxSearchDepth + 1]AtaxxMove
+	pvLength [MaxSearchDepth + 1]int
+}
+
+/* Compute the time budget for the next move, zero meaning unlimited.
+ *
+ * With a clock we spend a fraction of the remaining time plus most of the
+ * increment, but never more than half the remaining time.
+ */
+func (limits SearchLimits) Budget() time.Duration {
+	if limits.MoveTime > 0 {
+		return limits.MoveTime
+	}
+
+	if limits.Time > 0 {
+		budget := limits.Time/30 + limits.Increment/2
+		if budget > limits.Time/2 {
+			budget = limits.Time / 2
+		}
+		return budget
+	}
+
+	return 0
+}
+
+/* Create a new searcher using the given transposition table, which may be nil */
+func NewSearcher(transposition TranspositionTable) *Searcher {
+	weights := engineEvalWeights
+	return &Searcher{transposition: transposition, Weights: &weights, Book: engineBook, SolveEmpty: DefaultSolveEmpty, Threads: engineThreads, SearchFeatures: DefaultSearchFeatures}
+}
+
+/* Evaluate a position using the searcher's weights, in hundredths of a
+ * piece from X's point of view.
+ */
+func (search *Searcher) evaluate(game MinimaxableGameboard) int {
+	switch board := game.(type) {
+	case *AtaxxBitboard:
+		return clampHeuristic(search.Weights.Evaluate(board))
+	case *AtaxxBoard:
+		bitboard := board.ToBitboard()
+		return clampHeuristic(search.Weights.Evaluate(&bitboard))
+	}
+
+	return clampHeuristic(PieceValue * game.Score())
+}
+
+/* Score a position ply plies from the root: finished games by their result,
+ * see ScoreWin, others by the evaluation.
+ */
+func (search *Searcher) leafScore(game MinimaxableGameboard, ply int) int {
+	if game.Finished() {
+		return resultScore(game.Score(), ply)
+	}
+
+	return search.evaluate(game)
+}
+
+/* Number of nodes visited so far, including those of helpers */
+func (search *Searcher) Nodes() int {
+	return search.totalNodes()
+}
+
+/* Record the best line at the current ply: move followed by the best line of
+ * the child node.
+ */
+func (search *Searcher) updatePV(move AtaxxMove) {
+	ply := search.ply
+	if ply >= MaxSearchDepth {
+		return
+	}
+
+	search.pvTable[ply][0] = move
+	length := 1
+	if ply+1 < MaxSearchDepth {
+		length += copy(search.pvTable[ply][1:], search.pvTable[ply+1][:search.pvLength[ply+1]])
+	}
+	search.pvLength[ply] = length
+}
+
+/* Record that the current node only knows its best move, not the line */
+func (search *Searcher) truncatePV(move AtaxxMove) {
+	if search.ply < MaxSearchDepth {
+		search.pvTable[search.ply][0] = move
+		search.pvLength[search.ply] = 1
+	}
+}
+
+/* Perform a move during search, keeping track of the distance to the root */
+func (search *Searcher) makeMove(game MoveGameboard, move AtaxxMove, maximizingPlayer bool) SingleBitboard {
+	search.ply++
+	if search.ply > search.selDepth {
+		search.selDepth = search.ply
+	}
+
+	return game.MakeMove(move, maximizingPlayer)
+}
+
+/* Undo a move performed by makeMove */
+func (search *Searcher) unmakeMove(game MoveGameboard, move AtaxxMove, maximizingPlayer bool, captured SingleBitboard) {
+	game.UnmakeMove(move, maximizingPlayer, captured)
+	search.ply--
+}
+
+/* Collect statistics on the search so far, for an iteration of the given
+ * depth that resulted in the given score.
+ */
+func (search *Searcher) info(game MoveGameboard, maximizingPlayer bool, depth int, score int, elapsed time.Duration) SearchInfo {
+	info := SearchInfo{}
+	info.Depth = depth
+	info.SelDepth = search.selDepth
+	info.Score = score
+	info.PV = search.PrincipalVariation(game, maximizingPlayer, depth)
+	info.Nodes = search.totalNodes()
+	info.Time = elapsed
+	if elapsed > 0 {
+		info.NPS = int(float64(info.Nodes) / elapsed.Seconds())
+	}
+	if search.hashProbe > 0 {
+		info.HashHits = float64(search.hashHits) / float64(search.hashProbe)
+	}
+
+	return info
+}
+
+/* Format the principal variation in algebraic notation */
+func (info SearchInfo) PVString() string {
+	moves := make([]string, len(info.PV))
+	for i, move := range info.PV {
+		moves[i] = move.String()
+	}
+
+	return strings.Join(moves, " ")
+}
+
+/* Single line summary, for logging */
+func (info SearchInfo) String() string {
+	return fmt.Sprintf("depth %d seldepth %d score %d nodes %d nps %d time %v hashhits %.1f%% pv %s",
+		info.Depth, info.SelDepth, info.Score, info.Nodes, info.NPS,
+		info.Time.Round(time.Millisecond), 100*info.HashHits, info.PVString())
+}
+
+/* Count a node and check wether the search should be abandoned.
+ *
+ * Reading the clock and polling the context are relatively expensive, so
+ * they are only checked every 1024 nodes. Cancellation is always honoured,
+ * the deadline only once the search is interruptible, so the first
+ * iteration completes even with a tiny budget.
+ */
+func (search *Searcher) checkStop() bool {
+	search.nodes++
+	if search.stopped || search.nodes&1023 != 0 {
+		return search.stopped
+	}
+	atomic.StoreInt64(&search.published, int64(search.nodes))
+
+	select {
+	case <-search.done:
+		search.stopped = true
+	default:
+		if search.interruptible && !search.deadline.IsZero() && time.Now().After(search.deadline) {
+			search.stopped = true
+		}
+	}
+
+	return search.stopped
+}
+
+/* Iterative deepening search
+ *
+ * Search depth 1, 2, 3, ... until the depth limit is reached, the time budget
+ * is used up or the context is cancelled. Returns the best move and score
+ * found by the last completed iteration along with its depth.
+ *
+ * The first iteration is always completed unless the context is cancelled,
+ * so there is a move to play even with a tiny budget. When cancelled before,
+ * the first legal move is returned and the result is marked incomplete. As
+ * every iteration takes longer than all previous
+ * iterations combined, no new iteration is started after half the budget has
+ * passed.
+ *
+ * Iterations share the transposition table, so later iterations benefit from
+ * the work done by earlier ones.
+ *
+ * Positions found in the book are not searched at all, a book move is
+ * returned right away. Positions with at most SolveEmpty empty cells are
+ * given to the endgame solver first, see solveRoot, and only searched
+ * heuristically when it cannot tell the move to play.
+ *
+ * With more than one thread, helpers search the same position in parallel,
+ * see startHelpers.
+ */
+func (search *Searcher) IterativeDeepening(ctx context.Context, game MoveGameboard, maximizingPlayer bool, limits SearchLimits) (result SearchResult) {
+	search.done = ctx.Done()
+	start := time.Now()
+
+	if board, ok := game.(*AtaxxBitboard); ok && search.Book != nil {
+		if move, found := search.Book.Probe(board, maximizingPlayer); found {
+			result.Move, result.Score, result.Book = move, search.evaluate(game), true
+			result.Info = SearchInfo{Score: result.Score, PV: []AtaxxMove{move}, Time: time.Since(start)}
+			if search.OnInfo != nil {
+				search.OnInfo(result.Info)
+			}
+			return result
+		}
+	}
+	budget := limits.Budget()
+	if budget > 0 {
+		search.deadline = start.Add(budget)
+	}
+
+	maxDepth := MaxSearchDepth
+	if limits.Depth > 0 {
+		maxDepth = limits.Depth
+	}
+
+	stopHelpers := search.startHelpers(game, maximizingPlayer, maxDepth)
+	defer stopHelpers()
+
+	/* Few empty cells left, try to solve the game first */
+	board, _ := search.solverBoard(game)
+
+	search.hasPrevious = [2]bool{}
+	result.Move = PassMove
+	for depth := 1; depth <= maxDepth; depth++ {
+		move, score, solved, found := search.iteration(game, board, maximizingPlayer, depth)
+
+		/* A move found by the solver is proven, even if the search was
+		 * stopped while improving its score. Only a move the solver found
+		 * in an earlier iteration is better.
+		 */
+		if search.stopped && (!found || result.Solved) {
+			break
+		}
+		result.Move, result.Score, result.Depth, result.Solved = move, score, depth, solved
+		result.Info = search.info(game, maximizingPlayer, depth, score, time.Since(start))
+		search.interruptible = true
+
+		if search.OnInfo != nil {
+			search.OnInfo(result.Info)
+		}
+
+		/* Nothing left to search, for instance on a full board, or the
+		 * solver found the move to play along with its exact score.
+		 */
+		if game.Finished() || search.stopped || (found && !search.horizon) {
+			break
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if budget > 0 && time.Since(start) >= budget/2 {
+			break
+		}
+	}
+
+	/* Cancelled during the first iteration */
+	if result.Depth == 0 && !game.Finished() {
+		if moves := game.Moves(maximizingPlayer); len(moves) > 0 {
+			result.Move = moves[0]
+		}
+	}
+
+	result.Incomplete = ctx.Err() != nil
+	return result
+}
+
+/* Search a single iteration of iterative deepening, depth plies deep.
+ *
+ * board is the root position if it is left to the solver, nil otherwise.
+ * See solveRoot for the meaning of solved and found.
+ */
+func (search *Searcher) iteration(game MoveGameboard, board *AtaxxBitboard, maximizingPlayer bool, depth int) (move AtaxxMove, score int, solved bool, found bool) {
+	if board != nil {
+		move, score, solved, found = search.solveRoot(board, maximizingPlayer, depth-1)
+	}
+	if !found && !search.stopped {
+		/* Search depth 0 already looks one ply ahead */
+		var heuristic int
+		move, heuristic = search.aspirationSearch(game, maximizingPlayer, depth-1)
+		if !solved {
+			score = heuristic
+		}
+		if !search.stopped {
+			search.previousScores[(depth-1)%2], search.hasPrevious[(depth-1)%2] = heuristic, true
+		}
+	}
+
+	return move, score, solved, found
+}
+
+/* Half width of the first aspiration window, in hundredths of a piece */
+const aspirationWindow = 50
+
+/* Depth from which aspiration windows are used, shallower searches are too
+ * unstable for them to pay off.
+ */
+const aspirationMinDepth = 3
+
+/* Search the root position depth plies deep, see alphaBeta.
+ *
+ * With aspiration windows the search expects the score to be close to the
+ * one of the previous iteration of the same parity and starts with a narrow
+ * window around it, which cuts off more. Scores swing between odd and even
+ * depths, as the player moving last tends to be ahead, so the iteration
+ * right before is a poor guess. When the score falls outside of the window, the side
+ * it failed on is widened, doubling the distance every time, and the search
+ * is repeated.
+ */
+func (search *Searcher) aspirationSearch(game MoveGameboard, maximizingPlayer bool, depth int) (move AtaxxMove, score int) {
+	guess := search.previousScores[depth%2]
+	if !search.Aspiration || !search.hasPrevious[depth%2] || depth < aspirationMinDepth || ProvenScore(guess) {
+		return search.alphaBeta(game, maximizingPlayer, depth, -ScoreInfinity, ScoreInfinity)
+	}
+
+	lower, upper := aspirationWindow, aspirationWindow
+	for {
+		alpha, beta := guess-lower, guess+upper
+		if lower >= ScoreWin {
+			alpha = -ScoreInfinity
+		}
+		if upper >= ScoreWin {
+			beta = ScoreInfinity
+		}
+
+		move, score = search.alphaBeta(game, maximizingPlayer, depth, alpha, beta)
+		if search.stopped {
+			return move, score
+		}
+		if score <= alpha {
+			lower *= 2
+		} else if score >= beta {
+			upper *= 2
+		} else {
+			return move, score
+		}
+	}
+}
+
+/* Principal variation of the last search, for the given root position.
+ *
+ * The line collected during search is cut short at transposition table
+ * cutoffs, so it is extended by following the best moves stored in the
+ * table. At most depth moves are returned.
+ */
+func (search *Searcher) PrincipalVariation(game MoveGameboard, maximizingPlayer bool, depth int) []AtaxxMove {
+	pv := make([]AtaxxMove, 0, depth)
+	captures := make([]SingleBitboard, 0, depth)
+
+	player := maximizingPlayer
+	for len(pv) < depth {
+		/* Follow the collected line first, then the table */
+		var move AtaxxMove
+		if len(pv) < search.pvLength[0] {
+			move = search.pvTable[0][len(pv)]
+		} else if search.transposition != nil {
+			entry, found := search.transposition.Load(hashGameboard(game, player))
+			if !found {
+				break
+			}
+			move = entry.Move
+		} else {
+			break
+		}
+		if !isLegalMove(game, player, move) {
+			break
+		}
+
+		captures = append(captures, game.MakeMove(move, player))
+		pv = append(pv, move)
+		player = !player
+	}
+
+	/* Restore the original position */
+	for i := len(pv) - 1; i >= 0; i-- {
+		player = !player
+		game.UnmakeMove(pv[i], player, captures[i])
+	}
+
+	return pv
 }
 
 ///* The most naive playing algorithm. Use the score heuristic to immediately
@@ -166,7 +725,7 @@ func Minimax(game MinimaxableGameboard, color int, depth int) (maxBoard Minimaxa
  * By setting the hash table to nil the hashing implementation devolves to standard alpha-beta pruning.
  * For an in-depth explanation see that function.
  */
-func AlphaBeta(game MinimaxableGameboard, maximizingPlayer bool, depth int, alpha int, beta int) (bestBoard MinimaxableGameboard, bestScore int) {
+func AlphaBeta(game MoveGameboard, maximizingPlayer bool, depth int, alpha int, beta int) (bestMove AtaxxMove, bestScore int) {
 	return AlphaBetaTransposition(game, maximizingPlayer, depth, alpha, beta, nil)
 }
 
@@ -176,7 +735,7 @@ func AlphaBeta(game MinimaxableGameboard, maximizingPlayer bool, depth int, alph
  * no better moves can be found in a certain path using current heuristics.
  *
  * Return the best possible move a player can make based on given search depth
- * and its according score.
+ * and its according score. When the game is finished PassMove is returned.
  *
  * maximizingPlayer:
  * true  -> Player A
@@ -225,159 +784,292 @@ func AlphaBeta(game MinimaxableGameboard, maximizingPlayer bool, depth int, alph
  * Finally this function aims to be a bit faster by storing boards previously
  * evaluated in a hash table. Thereby preventing the recomputing of board
  * positions already seen.
+ *
+ * Moves are performed on the game board in place and undone before
+ * returning, so the board passed in is left unchanged.
+ */
+func AlphaBetaTransposition(game MoveGameboard, maximizingPlayer bool, depth int, alpha int, beta int, transposition TranspositionTable) (bestMove AtaxxMove, bestScore int) {
+	return NewSearcher(transposition).alphaBeta(game, maximizingPlayer, depth, alpha, beta)
+}
+
+/* Alpha-beta search that can be cancelled through the given context.
+ *
+ * If the context is cancelled before the search completes, the best move
+ * among the moves fully searched so far is returned and the result is marked
+ * incomplete. If not even the first move was searched, that move is returned
+ * with a score of zero.
+ */
+func AlphaBetaContext(ctx context.Context, game MoveGameboard, maximizingPlayer bool, depth int, alpha int, beta int, transposition TranspositionTable) (result SearchResult) {
+	search := NewSearcher(transposition)
+	search.done = ctx.Done()
+	search.interruptible = true
+
+	start := time.Now()
+	result.Move, result.Score = search.alphaBeta(game, maximizingPlayer, depth, alpha, beta)
+	result.Depth = depth + 1
+	result.Incomplete = search.stopped
+	result.Info = search.info(game, maximizingPlayer, result.Depth, result.Score, time.Since(start))
+
+	return result
+}
+
+/* The actual alpha-beta implementation, see AlphaBetaTransposition.
+ *
+ * Scores and the window are taken from X's point of view, as everywhere
+ * outside the search itself, which is done by negamax.
+ */
+func (search *Searcher) alphaBeta(game MoveGameboard, maximizingPlayer bool, depth int, alpha int, beta int) (bestMove AtaxxMove, bestScore int) {
+	if maximizingPlayer {
+		return search.negamax(game, maximizingPlayer, depth, alpha, beta)
+	}
+
+	bestMove, bestScore = search.negamax(game, maximizingPlayer, depth, -beta, -alpha)
+	return bestMove, -bestScore
+}
+
+/* Search not reducing moves below this depth, see lateMoveReduction */
+const lmrMinDepth = 3
+
+/* Number of moves searched at full depth before reducing any, see
+ * lateMoveReduction
+ */
+const lmrMinMoves = 3
+
+/* Alpha-beta search in negamax form
+ *
+ * Unlike alphaBeta, scores and the window are taken from the point of view
+ * of the player to move, so both players share the same code: the score of
+ * a move is the negated score of the position after it, searched with the
+ * negated window. The transposition table keeps scores from X's point of
+ * view, as the solver shares it.
+ *
+ * With PVS only the first move is searched with the full window. Every later
+ * move is searched with a null window around alpha first, which merely tells
+ * wether it is better than the best move so far, and only re-searched with
+ * the full window if it is. With moves well ordered that proof fails rarely.
+ *
+ * Once the search has been stopped this returns as soon as possible, with
+ * the best move among the moves completely searched. The results of an
+ * interrupted search will not be stored in the transposition table.
  */
-func AlphaBetaTransposition(game MinimaxableGameboard, maximizingPlayer bool, depth int, alpha int, beta int, transposition TranspositionTable) (bestBoard MinimaxableGameboard, bestScore int) {
+func (search *Searcher) negamax(game MoveGameboard, maximizingPlayer bool, depth int, alpha int, beta int) (bestMove AtaxxMove, bestScore int) {
+	if search.checkStop() {
+		return PassMove, 0
+	}
+	if search.ply < MaxSearchDepth {
+		search.pvLength[search.ply] = 0
+	}
+
+	/* Converts scores from X's point of view to the mover's and back */
+	sign := 1
+	if !maximizingPlayer {
+		sign = -1
+	}
+
+	/* The best move stored for this position, searched first */
+	var hashMove AtaxxMove
+	var hashFound bool
+
 	/* If transposition is nil, this function acts like standard alpha-beta pruning */
+	transposition := search.transposition
 	if transposition != nil {
 		/* Handle hash table in a compact Golang fashion.
 		 * Using a check at the start, and a defer to cache the function result at the end.
 		 */
-		hashBoard, hashScore, found := transposition.Load(game, maximizingPlayer, depth, alpha, beta)
+		key := hashGameboard(game, maximizingPlayer)
+		entry, found := transposition.Load(key)
+		search.hashProbe++
 		if found {
+			search.hashHits++
+			hashMove, hashFound = entry.Move, true
+		}
+		if found && entry.Origin == OriginSearch && entry.Depth >= depth {
 			/* Debug hash table behaviour */
-			if false {
-				abBoard, abScore := AlphaBeta(game, maximizingPlayer, depth, alpha, beta)
-				if *(hashBoard.(*AtaxxBoard)) != *(abBoard.(*AtaxxBoard)) || hashScore != abScore {
+			if false && entry.Bound == BoundExact && entry.Depth == depth {
+				abMove, abScore := AlphaBeta(game, maximizingPlayer, depth, -ScoreInfinity, ScoreInfinity)
+				if entry.Score != abScore {
 					fmt.Println("Input board", game, "maximizingPlayer", maximizingPlayer)
 					fmt.Println("At depth", depth)
-					fmt.Println("alpha", alpha, "beta", beta)
-					fmt.Println("hashBoard", hashBoard, "hashScore", hashScore)
+					fmt.Println("hashMove", entry.Move, "hashScore", entry.Score)
 					fmt.Println("vs.")
-					fmt.Println("abBoard", abBoard, "abScore", abScore)
+					fmt.Println("abMove", abMove, "abScore", abScore)
 					panic("Not equal, terminating.")
 				}
 			}
-			return hashBoard, hashScore
+
+			/* An exact score can be used as is, bounds can narrow the
+			 * alpha-beta window, possibly closing it completely. A lower
+			 * bound on X's score is an upper bound on O's.
+			 */
+			score := sign * scoreFromTable(entry.Score, search.ply)
+			bound := entry.Bound
+			if !maximizingPlayer {
+				bound = bound.negated()
+			}
+			switch bound {
+			case BoundExact:
+				search.truncatePV(entry.Move)
+				return entry.Move, score
+			case BoundLower:
+				if score > alpha {
+					alpha = score
+				}
+			case BoundUpper:
+				if score < beta {
+					beta = score
+				}
+			}
+			if alpha >= beta {
+				search.truncatePV(entry.Move)
+				return entry.Move, score
+			}
 		}
 
 		/* In case the result was not in our hashtable.
 		 * Setup a save statement for when this function returns.
 		 *
-		 * This function takes all function arguments as its parameters to prevent
-		 * changes to these variables later on to mess with the eventual hash entry
-		 * stored. We are essentially caching function calls, and we don't want
-		 * variable changes to affect the function call cached.
+		 * This function takes the window as its parameters to prevent
+		 * changes to these variables later on to mess with the bound type of
+		 * the eventual hash entry stored.
 		 */
-		defer func(game MinimaxableGameboard, maximizingPlayer bool, depth int, alpha int, beta int) {
-			//fmt.Println("bestBoard", bestBoard, "bestScore", bestScore)
-			transposition.Store(game, maximizingPlayer, depth, alpha, beta, bestBoard, bestScore)
-		}(game, maximizingPlayer, depth, alpha, beta)
-	}
+		defer func(alpha int, beta int) {
+			if search.stopped {
+				return
+			}
 
-	boards := game.NextBoards(maximizingPlayer)
+			/* Scores outside the window are only bounds on the real score */
+			bound := BoundExact
+			if bestScore <= alpha {
+				bound = BoundUpper
+			} else if bestScore >= beta {
+				bound = BoundLower
+			}
+			if !maximizingPlayer {
+				bound = bound.negated()
+			}
+			transposition.Store(key, TranspositionEntry{bestMove, scoreToTable(sign*bestScore, search.ply), depth, bound, OriginSearch})
+		}(alpha, beta)
+	}
 
-	var maxBoard, minBoard MinimaxableGameboard
-	var maxScore, minScore int
+	moves := game.Moves(maximizingPlayer)
 
 	/* In case the game has finish, return current game state */
-	if len(boards) == 0 {
-		return game, game.Score()
+	if len(moves) == 0 {
+		return PassMove, sign * resultScore(game.Score(), search.ply)
 	}
 
 	/* If we have reached maximum search depth, heuristically evaluate game
 	 * boards.
 	 */
 	if depth == 0 {
-		/* Handle maximizing player */
-		if maximizingPlayer {
-			for i, board := range boards {
-				/* Compute position heurstic */
-				newScore := board.Score()
-
-				/* Store best board seen */
-				if i == 0 {
-					maxScore = newScore
-					maxBoard = board
-				} else {
-					if newScore > maxScore {
-						maxScore = newScore
-						maxBoard = board
-					}
-				}
-			}
+		/* Children are evaluated without visiting them */
+		if search.ply+1 > search.selDepth {
+			search.selDepth = search.ply + 1
+		}
+		defer func() { search.truncatePV(bestMove) }()
 
-			/* Return best board available */
-			//fmt.Println("maxBoard", maxBoard, "maxScore", maxScore)
-			return maxBoard, maxScore
-		} else { /* Handle minimizing player */
-			for i, board := range boards {
-				/* Compute position heurstic */
-				newScore := board.Score()
-
-				/* Store best board seen (in our case, lowest score possible) */
-				if i == 0 {
-					minScore = newScore
-					minBoard = board
-				} else {
-					if newScore < minScore {
-						minScore = newScore
-						minBoard = board
-					}
-				}
+		for i, move := range moves {
+			/* Compute position heurstic */
+			captured := game.MakeMove(move, maximizingPlayer)
+			newScore := sign * search.leafScore(game, search.ply+1)
+			game.UnmakeMove(move, maximizingPlayer, captured)
+
+			/* Store best move seen */
+			if i == 0 || newScore > bestScore {
+				bestMove, bestScore = move, newScore
+			}
+			/* Any better move would not be played either */
+			if bestScore >= beta {
+				break
 			}
-			//fmt.Println("minBoard", minBoard, "minScore", minScore)
-			return minBoard, minScore
 		}
+
+		return bestMove, bestScore
 	}
 
-	/* If we are not at maximum search depth, iterate the various boards and
+	/* If we are not at maximum search depth, iterate the various moves and
 	 * score them by recursively evaluating the underlying game trees.
 	 */
+	search.orderMoves(game, moves, maximizingPlayer, hashMove, hashFound)
 
-	/* Handle maximizing player */
-	if maximizingPlayer {
-		for i, board := range boards {
-			/* Compute enemy score by recursing */
-			_, newScore := AlphaBetaTransposition(board, !maximizingPlayer, depth-1, alpha, beta, transposition)
+	for i, move := range moves {
+		/* Compute enemy score by recursing */
+		captured := search.makeMove(game, move, maximizingPlayer)
+		newScore := search.searchMove(game, !maximizingPlayer, depth, alpha, beta, i, search.lateMoveReduction(move, captured, depth, i))
+		search.unmakeMove(game, move, maximizingPlayer, captured)
 
-			/* Store best board seen */
+		/* Abandon search, returning the best completely searched move */
+		if search.stopped {
 			if i == 0 {
-				maxScore = newScore
-				maxBoard = board
-			} else {
-				if newScore > maxScore {
-					maxScore = newScore
-					maxBoard = board
-				}
-			}
-			/* Update alpha if necessary */
-			if maxScore > alpha {
-				alpha = maxScore
-			}
-			/* Terminate if known suboptimal branch found */
-			if alpha >= beta {
-				//fmt.Println("maxBoard", maxBoard, "maxScore", maxScore)
-				return maxBoard, maxScore
+				return move, 0
 			}
+			return bestMove, bestScore
 		}
-		//fmt.Println("maxBoard", maxBoard, "maxScore", maxScore)
-		return maxBoard, maxScore
-	} else { /* Handle minimizing player */
-		for i, board := range boards {
-			/* Compute enemy score by recursing */
-			_, newScore := AlphaBetaTransposition(board, !maximizingPlayer, depth-1, alpha, beta, transposition)
 
-			/* Store best board seen (in our case, lowest score possible) */
-			if i == 0 {
-				minScore = newScore
-				minBoard = board
-			} else {
-				if newScore < minScore {
-					minScore = newScore
-					minBoard = board
-				}
-			}
-			/* Update beta if necessary */
-			if minScore < beta {
-				beta = minScore
-			}
-			/* Terminate if known suboptimal branch found */
-			if alpha >= beta {
-				//fmt.Println("minBoard", minBoard, "minScore", minScore)
-				return minBoard, minScore
+		/* Store best move seen */
+		if i == 0 || newScore > bestScore {
+			bestMove, bestScore = move, newScore
+			search.updatePV(move)
+		}
+		/* Update alpha if necessary */
+		if bestScore > alpha {
+			alpha = bestScore
+		}
+		/* Terminate if known suboptimal branch found */
+		if alpha >= beta {
+			if captured == 0 {
+				search.recordCutoff(move, maximizingPlayer, depth)
 			}
+			return bestMove, bestScore
 		}
-		//fmt.Println("minBoard", minBoard, "minScore", minScore)
-		return minBoard, minScore
 	}
+
+	return bestMove, bestScore
+}
+
+/* Score the i-th move of a node at the given depth, the move already
+ * performed and the opponent to move. See negamax for PVS.
+ *
+ * A move reduced by late move reductions that still turns out better than
+ * alpha is searched again at full depth, as the reduction may have hidden
+ * its refutation.
+ */
+func (search *Searcher) searchMove(game MoveGameboard, maximizingPlayer bool, depth int, alpha int, beta int, i int, reduction int) int {
+	if i == 0 {
+		_, score := search.negamax(game, maximizingPlayer, depth-1, -beta, -alpha)
+		return -score
+	}
+
+	/* Upper end of the window of the first try */
+	window := beta
+	if search.PVS {
+		window = alpha + 1
+	}
+
+	_, score := search.negamax(game, maximizingPlayer, depth-1-reduction, -window, -alpha)
+	score = -score
+	if reduction > 0 && score > alpha && !search.stopped {
+		_, score = search.negamax(game, maximizingPlayer, depth-1, -window, -alpha)
+		score = -score
+	}
+	if window < beta && score > alpha && score < beta && !search.stopped {
+		_, score = search.negamax(game, maximizingPlayer, depth-1, -beta, -alpha)
+		score = -score
+	}
+
+	return score
+}
+
+/* Number of plies to reduce the search of the i-th move of a node by.
+ *
+ * Late move reductions search moves that come late in the move ordering one
+ * ply shallower. Only quiet jumps are reduced: jumps that do not capture
+ * anything, leaving a hole behind, are rarely good.
+ */
+func (search *Searcher) lateMoveReduction(move AtaxxMove, captured SingleBitboard, depth int, i int) int {
+	if !search.LMR || depth < lmrMinDepth || i < lmrMinMoves || !move.IsDouble() || captured != 0 {
+		return 0
+	}
+
+	return 1
 }
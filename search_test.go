@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+/* Positions from the opening, middlegame and ending */
+var searchPositions = []string{
+	StartFEN,
+	"x5o/7/2-1-2/7/2-1-2/7/o5x x 0 1",
+	"7/1xx1o2/1xoxoo1/2xxo2/1oxo3/2o4/7 x 0 10",
+	"xxxo1oo/xxoooox/xoxxxoo/ooxxoxx/xoooxxo/oxx1xo1/ooxoxoo o 0 40",
+}
+
+/* Ordering moves and PVS may only change the order and the windows of the
+ * search, not its result. Late move reductions do, so they are left out.
+ */
+func TestSearchFeaturesScore(t *testing.T) {
+	features := map[string]SearchFeatures{
+		"ordering": {OrderMoves: true},
+		"pvs":      {PVS: true},
+		"both":     {OrderMoves: true, PVS: true},
+	}
+
+	for _, fen := range searchPositions {
+		board, state, err := ParseBitboardFEN(fen)
+		if err != nil {
+			t.Fatalf("%s: %v", fen, err)
+		}
+
+		plain := NewSearcher(nil)
+		plain.SearchFeatures = SearchFeatures{}
+		_, expected := plain.alphaBeta(board, state.MaximizingPlayer, 3, -ScoreInfinity, ScoreInfinity)
+
+		for name, enabled := range features {
+			search := NewSearcher(nil)
+			search.SearchFeatures = enabled
+			if _, score := search.alphaBeta(board, state.MaximizingPlayer, 3, -ScoreInfinity, ScoreInfinity); score != expected {
+				t.Errorf("%s: score %d with %s, expected %d", fen, score, name, expected)
+			}
+		}
+	}
+}
+
+/* Search all positions to a fixed depth, reporting the nodes visited. Run
+ * with -bench SearchOrdering to compare node counts with and without move
+ * ordering.
+ */
+func BenchmarkSearchOrdering(b *testing.B) {
+	for _, ordered := range []bool{false, true} {
+		name := "unordered"
+		if ordered {
+			name = "ordered"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			nodes := 0
+			for i := 0; i < b.N; i++ {
+				for _, fen := range searchPositions {
+					board, state, _ := ParseBitboardFEN(fen)
+					search := NewSearcher(NewBitTranspositionTable(1 << 16))
+					search.Book, search.Threads, search.OrderMoves = nil, 1, ordered
+					search.IterativeDeepening(context.Background(), board, state.MaximizingPlayer, SearchLimits{Depth: 5})
+					nodes += search.Nodes()
+				}
+			}
+			b.ReportMetric(float64(nodes)/float64(b.N), "nodes/op")
+		})
+	}
+}
+
+/* The node count of the bench command is used as signature of the search,
+ * so it must not vary between runs.
+ */
+func TestBenchSignature(t *testing.T) {
+	first, err := Bench(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := Bench(3)
+
+	for i := range first {
+		if first[i].Nodes != second[i].Nodes {
+			t.Errorf("%s: %d nodes, then %d", first[i].FEN, first[i].Nodes, second[i].Nodes)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+/* Server side game sessions */
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* Instead of trusting whatever position a client posts, the server keeps
+ * the authoritative state of every game it hosts:
+ *
+ *  POST /games                 -> create a game, {"layout": ..., "fen": ...,
+ *                                 "level": ...}
+ *  GET  /games/{id}            -> current position, move list and result
+ *  POST /games/{id}/moves      -> play a move, {"move": "a1c3"}
+ *  POST /games/{id}/ply        -> let the computer move, {"move_time": 1000}
+ *                                 optionally overriding the game's level
+ *  GET  /games/{id}/ws         -> live events over WebSocket, see live.go
+ *  GET  /games/{id}/pgn        -> game record as text, see GameRecord
+ *  DELETE /games/{id}          -> remove the game, 204 without body
+ *
+ * All others respond with the game as GameView (the computer move with
+ * GamePlyResult), moves are validated against the server's own board.
+ */
+
+/* Games without activity for this long are removed */
+const sessionLifetime = 24 * time.Hour
+
+/* Returned when trying to move while the computer is thinking */
+var ErrSearchRunning = errors.New("game: computer is thinking")
+
+/* A single hosted game */
+type gameSession struct {
+	id string
+
+	mutex     sync.Mutex
+	game      *AtaxxGame
+	level     Difficulty
+	created   time.Time
+	lastUsed  time.Time
+	searching bool
+
+	/* For the game record: who played each side (indexed like uaiLimits)
+	 * and a comment per move.
+	 */
+	players  [2]string
+	comments []string
+
+	/* WebSocket clients following the game, with their queued events */
+	watchMutex sync.Mutex
+	watchers   map[*WebSocket]chan []byte
+}
+
+/* All games hosted by the server */
+type GameStore struct {
+	mutex sync.Mutex
+	games map[string]*gameSession
+}
+
+/* Game state as returned to clients.
+ *
+ * Embeds AtaxxPly, so the web interface can use it like the responses of
+ * the stateless endpoints.
+ */
+type GameView struct {
+	ID string `json:"id"`
+	AtaxxPly
+	FEN    string   `json:"fen"`
+	Moves  []string `json:"moves"`
+	Reason string   `json:"reason,omitempty"`
+	Level  string   `json:"level"`
+}
+
+/* Computer move response, the game plus the move played */
+type GamePlyResult struct {
+	GameView
+	Move  string `json:"move"`
+	Score int    `json:"score"`
+}
+
+/* Game creation request, all fields are optional */
+type GameCreateRequest struct {
+	Layout string `json:"layout"`
+	FEN    string `json:"fen"`
+
+	/* Difficulty of the computer opponent, see DifficultyLevels */
+	Level string `json:"level"`
+}
+
+/* Move request for a hosted game */
+type GameMoveRequest struct {
+	Move string `json:"move"`
+}
+
+/* Build an empty game store */
+func NewGameStore() *GameStore {
+	store := GameStore{}
+	store.games = make(map[string]*gameSession)
+
+	return &store
+}
+
+/* Generate a random, unguessable game ID */
+func newGameID() string {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(id[:])
+}
+
+/* Start a new game from a layout name or FEN, see ParseLayout */
+func (store *GameStore) Create(layout string, level Difficulty) (string, *gameSession, error) {
+	board, state, err := ParseLayout(layout)
+	if err != nil {
+		return "", nil, err
+	}
+	game, err := NewAtaxxGame(board.FEN(state))
+	if err != nil {
+		return "", nil, err
+	}
+	session := &gameSession{game: game, level: level, created: time.Now(), lastUsed: time.Now()}
+	session.watchers = make(map[*WebSocket]chan []byte)
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	/* Cleanup abandoned games while we're at it */
+	for id, old := range store.games {
+		old.mutex.Lock()
+		expired := time.Since(old.lastUsed) > sessionLifetime
+		old.mutex.Unlock()
+		if expired {
+			delete(store.games, id)
+		}
+	}
+
+	session.id = newGameID()
+	store.games[session.id] = session
+
+	return session.id, session, nil
+}
+
+/* Lookup a game by ID */
+func (store *GameStore) Get(id string) (*gameSession, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	session, found := store.games[id]
+	return session, found
+}
+
+/* Remove a game, disconnecting everyone watching it. Returns false if
+ * there is no such game.
+ */
+func (store *GameStore) Delete(id string) bool {
+	store.mutex.Lock()
+	session, found := store.games[id]
+	delete(store.games, id)
+	store.mutex.Unlock()
+
+	if found {
+		session.disconnectWatchers()
+	}
+	return found
+}
+
+/* Describe the game, the session lock must be held */
+func (session *gameSession) view() GameView {
+	game := session.game
+
+	view := GameView{}
+	view.ID = session.id
+	view.Board = game.Board.ToBoard()
+	view.MaximizingPlayer = game.MaximizingPlayer
+	view.Result, view.Reason = game.ResultReason()
+	view.Level = session.level.Name
+	view.FEN = game.FEN()
+	view.Moves = make([]string, len(game.Moves))
+	for i, move := range game.Moves {
+		view.Moves[i] = move.String()
+	}
+
+	return view
+}
+
+/* Current state of the game */
+func (session *gameSession) View() GameView {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	return session.view()
+}
+
+/* Play a move given in algebraic notation */
+func (session *gameSession) PlayMove(notation string) (GameView, error) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.searching {
+		return GameView{}, ErrSearchRunning
+	}
+	side := boolIndex(session.game.MaximizingPlayer)
+	if err := session.game.PlayNotation(notation); err != nil {
+		return GameView{}, err
+	}
+	session.lastUsed = time.Now()
+	session.played(side, "Human", "")
+
+	view := session.view()
+	session.broadcastMove(notation, view)
+
+	return view, nil
+}
+
+/* Let the computer play a move at the given difficulty level, or the
+ * game's own level when the name is empty. Timed levels think for at most
+ * moveTime.
+ *
+ * Only a single search runs per game, during which no other moves are
+ * accepted. The game itself remains readable while the computer is thinking.
+ */
+func (session *gameSession) ComputerMove(ctx context.Context, levelName string, moveTime time.Duration) (GamePlyResult, error) {
+	session.mutex.Lock()
+	level := session.level
+	if levelName != "" {
+		var err error
+		if level, err = ParseDifficulty(levelName); err != nil {
+			session.mutex.Unlock()
+			return GamePlyResult{}, NewAPIError(http.StatusBadRequest, "invalid_level", err)
+		}
+	}
+	if session.searching {
+		session.mutex.Unlock()
+		return GamePlyResult{}, ErrSearchRunning
+	}
+	if result := session.game.Result(); result != ResultNone {
+		session.mutex.Unlock()
+		return GamePlyResult{}, fmt.Errorf("%w (%v)", ErrGameOver, result)
+	}
+	session.searching = true
+	board := session.game.Board
+	maximizingPlayer := session.game.MaximizingPlayer
+	session.mutex.Unlock()
+
+	defer func() {
+		session.mutex.Lock()
+		session.searching = false
+		session.mutex.Unlock()
+	}()
+
+	searcher := NewSearcher(NewBitTranspositionTable(160000))
+	searcher.OnInfo = session.broadcastInfo
+	result := level.ChooseMove(ctx, searcher, &board, maximizingPlayer, moveTime)
+	if result.Incomplete {
+		log.Println("/games:", session.id, "search aborted:", ctx.Err())
+		return GamePlyResult{}, errSearchAborted
+	}
+	log.Println("/games:", session.id, level.Name, result.Info)
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if err := session.game.Play(result.Move); err != nil {
+		return GamePlyResult{}, err
+	}
+	session.lastUsed = time.Now()
+	session.played(boolIndex(maximizingPlayer), uaiEngineName+" "+level.Name, SearchComment(result))
+
+	var rply GamePlyResult
+	rply.GameView = session.view()
+	rply.Move = result.Move.String()
+	rply.Score = result.Score
+	session.broadcastMove(rply.Move, rply.GameView)
+
+	return rply, nil
+}
+
+/* Remember who played a move, the session lock must be held.
+ *
+ * A side is named after whoever made its first move.
+ */
+func (session *gameSession) played(side int, player string, comment string) {
+	if session.players[side] == "" {
+		session.players[side] = player
+	}
+	session.comments = append(session.comments, comment)
+}
+
+/* Game record of the session */
+func (session *gameSession) Record() *GameRecord {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	record := NewGameRecord(session.game)
+	record.SetTag("Event", "go-ataxx game "+session.id)
+	record.SetTag("Date", session.created.Format("2006.01.02"))
+	for side, tag := range [2]string{"White", "Black"} {
+		if player := session.players[side]; player != "" {
+			record.SetTag(tag, player)
+		}
+	}
+	if result, reason := session.game.ResultReason(); result != ResultNone {
+		record.SetTag("Termination", reason)
+	}
+	for i, comment := range session.comments {
+		record.Moves[i].Comment = comment
+	}
+
+	return record
+}
+
+/* Route requests for /games and /games/... */
+func (store *GameStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/games"), "/")
+	if path == "" {
+		if r.Method != http.MethodPost {
+			writeError(w, errMethodNotAllowed)
+			return
+		}
+		store.handleCreate(w, r)
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	session, found := store.Get(parts[0])
+	if !found || len(parts) > 2 {
+		writeError(w, errNotFound)
+		return
+	}
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		view := session.View()
+		writeJSON(w, http.StatusOK, &view)
+
+	case action == "moves" && r.Method == http.MethodPost:
+		session.handleMove(w, r)
+
+	case action == "ply" && r.Method == http.MethodPost:
+		session.handlePly(w, r)
+
+	case action == "ws":
+		session.handleWatch(w, r)
+
+	case action == "pgn" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		session.Record().Write(w)
+
+	case action == "" && r.Method == http.MethodDelete:
+		if !store.Delete(session.id) {
+			writeError(w, errNotFound)
+			return
+		}
+		log.Println("/games: deleted game", session.id)
+		w.WriteHeader(http.StatusNoContent)
+
+	case action == "" || action == "moves" || action == "ply" || action == "pgn":
+		writeError(w, errMethodNotAllowed)
+
+	default:
+		writeError(w, errNotFound)
+	}
+}
+
+/* POST /games */
+func (store *GameStore) handleCreate(w http.ResponseWriter, r *http.Request) {
+	/* An empty body selects the standard layout */
+	var request GameCreateRequest
+	if err := decodeJSON(r, &request); err != nil && err != io.EOF {
+		writeError(w, err)
+		return
+	}
+	layout := request.Layout
+	if request.FEN != "" {
+		layout = request.FEN
+	}
+
+	level, err := ParseDifficulty(request.Level)
+	if err != nil {
+		writeError(w, NewAPIError(http.StatusBadRequest, "invalid_level", err))
+		return
+	}
+
+	id, session, err := store.Create(layout, level)
+	if err != nil {
+		writeError(w, NewAPIError(http.StatusBadRequest, "invalid_layout", err))
+		return
+	}
+	log.Println("/games: created game", id)
+
+	view := session.View()
+	writeJSON(w, http.StatusCreated, &view)
+}
+
+/* POST /games/{id}/moves */
+func (session *gameSession) handleMove(w http.ResponseWriter, r *http.Request) {
+	var request GameMoveRequest
+	if err := decodeJSON(r, &request); err != nil {
+		if err == io.EOF {
+			err = NewAPIError(http.StatusBadRequest, "invalid_json", errors.New("json: missing move"))
+		}
+		writeError(w, err)
+		return
+	}
+
+	view, err := session.PlayMove(request.Move)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &view)
+}
+
+/* POST /games/{id}/ply */
+func (session *gameSession) handlePly(w http.ResponseWriter, r *http.Request) {
+	var request AtaxxPlyRequest
+	if err := decodeJSON(r, &request); err != nil && err != io.EOF {
+		writeError(w, err)
+		return
+	}
+
+	rply, err := session.ComputerMove(r.Context(), request.Level, request.thinkTime())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &rply)
+}
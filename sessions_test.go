@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/* Send a request to the game store, with a JSON body unless empty */
+func serveGames(store *GameStore, method, path, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	recorder := httptest.NewRecorder()
+	store.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+/* Decode a JSON response, failing the test for anything else */
+func decodeResponse(t *testing.T, recorder *httptest.ResponseRecorder, status int, value interface{}) {
+	t.Helper()
+	if recorder.Code != status {
+		t.Fatalf("status %d, expected %d: %s", recorder.Code, status, recorder.Body.String())
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Fatalf("content type %q", contentType)
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), value); err != nil {
+		t.Fatalf("%v: %s", err, recorder.Body.String())
+	}
+}
+
+func TestGameSessionLifecycle(t *testing.T) {
+	store := NewGameStore()
+
+	/* Create */
+	var created GameView
+	decodeResponse(t, serveGames(store, http.MethodPost, "/games", `{"layout": "gaps", "level": "easy"}`), http.StatusCreated, &created)
+	if created.ID == "" || created.FEN != StartingLayouts["gaps"] || created.Level != "easy" ||
+		!created.MaximizingPlayer || len(created.Moves) != 0 || created.Result != ResultNone {
+		t.Fatalf("created %+v", created)
+	}
+	path := "/games/" + created.ID
+
+	/* Get */
+	var view GameView
+	decodeResponse(t, serveGames(store, http.MethodGet, path, ""), http.StatusOK, &view)
+	if view.ID != created.ID || view.FEN != created.FEN {
+		t.Errorf("got %+v, expected %+v", view, created)
+	}
+
+	/* Human move */
+	decodeResponse(t, serveGames(store, http.MethodPost, path+"/moves", `{"move": "b6"}`), http.StatusOK, &view)
+	if view.MaximizingPlayer || len(view.Moves) != 1 || view.Moves[0] != "b6" {
+		t.Errorf("after b6: %+v", view)
+	}
+
+	/* Computer move, at a different level than the game's */
+	var ply GamePlyResult
+	decodeResponse(t, serveGames(store, http.MethodPost, path+"/ply", `{"level": "greedy"}`), http.StatusOK, &ply)
+	if ply.Move == "" || len(ply.Moves) != 2 || ply.Moves[1] != ply.Move || !ply.MaximizingPlayer || ply.Level != "easy" {
+		t.Errorf("after computer move: %+v", ply)
+	}
+
+	/* Record, naming who played which side */
+	recorder := serveGames(store, http.MethodGet, path+"/pgn", "")
+	records, err := ReadGameRecords(recorder.Body)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("record: %v", err)
+	}
+	if records[0].Tag("Black") != "Human" || !strings.HasSuffix(records[0].Tag("White"), "greedy") || len(records[0].Moves) != 2 {
+		t.Errorf("record %+v", records[0])
+	}
+
+	/* Delete, after which the game is gone */
+	if recorder := serveGames(store, http.MethodDelete, path, ""); recorder.Code != http.StatusNoContent || recorder.Body.Len() != 0 {
+		t.Errorf("delete: status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		if recorder := serveGames(store, method, path, ""); recorder.Code != http.StatusNotFound {
+			t.Errorf("%s after delete: status %d", method, recorder.Code)
+		}
+	}
+}
+
+/* An empty body creates a game from the standard position */
+func TestGameSessionCreateDefault(t *testing.T) {
+	var view GameView
+	decodeResponse(t, serveGames(NewGameStore(), http.MethodPost, "/games", ""), http.StatusCreated, &view)
+	if view.FEN != StartFEN || view.Level != DefaultDifficulty {
+		t.Errorf("created %+v", view)
+	}
+}
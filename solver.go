@@ -0,0 +1,373 @@
+/* Exact search of endgames */
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+/* Scores of decided games, "mate-like" scores
+ *
+ * A game won by X with a final disc difference of d, ending n plies from
+ * the root of the search, scores
+ *
+ *  ScoreWin + d*scorePerDisc - n
+ *
+ * and a game won by O the negation of that. Drawn games score zero.
+ *
+ * Every decided game thus scores beyond any heuristic evaluation, which is
+ * kept within ±ScoreWin. Among wins the larger disc difference is preferred,
+ * and among equal wins the quicker one, so the engine makes progress in a won
+ * ending instead of postponing it forever.
+ */
+const ScoreWin = 1 << 16
+
+/* Score of a single disc in decided games, exceeding any number of plies */
+const scorePerDisc = 256
+
+/* Number of empty cells at which searches switch to the solver by default */
+const DefaultSolveEmpty = 6
+
+/* Depth stored in the transposition table for results that do not depend on
+ * the search depth, as the whole subtree was searched until the end of the
+ * game. Such entries are usable at any depth.
+ */
+const solvedDepth = 127
+
+/* Score of a finished game with the given disc difference from X's point of
+ * view, ply plies from the root.
+ */
+func resultScore(discs int, ply int) int {
+	if discs > 0 {
+		return ScoreWin + discs*scorePerDisc - ply
+	} else if discs < 0 {
+		return -ScoreWin + discs*scorePerDisc + ply
+	}
+
+	return 0
+}
+
+/* Wether a score tells the game is won or lost, rather than estimating */
+func ProvenScore(score int) bool {
+	return score > ScoreWin || score < -ScoreWin
+}
+
+/* Decode a proven score into the final disc difference from X's point of
+ * view and the number of plies until the game ends.
+ *
+ * ok is false for other scores, including draws, which cannot be told apart
+ * from equal heuristic scores.
+ */
+func DecodeResultScore(score int) (discs int, plies int, ok bool) {
+	if !ProvenScore(score) {
+		return 0, 0, false
+	}
+
+	sign := 1
+	if score < 0 {
+		sign, score = -1, -score
+	}
+	score -= ScoreWin
+	discs = (score + scorePerDisc - 1) / scorePerDisc
+	plies = discs*scorePerDisc - score
+
+	return sign * discs, plies, true
+}
+
+/* Format a score in pieces from X's point of view, decided games as the
+ * number of moves until the end, e.g. "+1.25" or "-M3".
+ */
+func ScoreString(score int) string {
+	discs, plies, ok := DecodeResultScore(score)
+	if !ok {
+		return fmt.Sprintf("%+.2f", float64(score)/PieceValue)
+	}
+
+	sign := "+"
+	if discs < 0 {
+		sign = "-"
+	}
+	return fmt.Sprintf("%sM%d", sign, (plies+1)/2)
+}
+
+/* Keep heuristic scores clear of the scores of decided games */
+func clampHeuristic(score int) int {
+	if score > ScoreWin {
+		return ScoreWin
+	} else if score < -ScoreWin {
+		return -ScoreWin
+	}
+
+	return score
+}
+
+/* Scores in the transposition table count the plies from the stored
+ * position, rather than from the root of the search storing it.
+ */
+func scoreToTable(score int, ply int) int {
+	if score > ScoreWin {
+		return score + ply
+	} else if score < -ScoreWin {
+		return score - ply
+	}
+
+	return score
+}
+
+/* Convert a score loaded from the transposition table, see scoreToTable */
+func scoreFromTable(score int, ply int) int {
+	if score > ScoreWin {
+		return score - ply
+	} else if score < -ScoreWin {
+		return score + ply
+	}
+
+	return score
+}
+
+/* The board of the root position, if it is left to the solver */
+func (search *Searcher) solverBoard(game MoveGameboard) (*AtaxxBitboard, bool) {
+	board, ok := game.(*AtaxxBitboard)
+	if !ok || board.EmptyCells() > search.SolveEmpty {
+		return nil, false
+	}
+
+	return board, true
+}
+
+/* Order moves for the solver: the move from the transposition table first,
+ * then singles, which fill an empty cell and so bring the end closer, and
+ * jumps last.
+ */
+func orderSolverMoves(moves []AtaxxMove, hashMove AtaxxMove, found bool) {
+	rank := func(move AtaxxMove) int {
+		if found && move == hashMove {
+			return 0
+		} else if move.IsSingle() {
+			return 1
+		}
+		return 2
+	}
+
+	sort.SliceStable(moves, func(i, j int) bool { return rank(moves[i]) < rank(moves[j]) })
+}
+
+/* Solve the root position, searching depth jumps deep, see solve
+ *
+ * Rather than searching for the best score, which mostly means comparing
+ * heuristic scores, null window searches ask wether the player to move wins,
+ * and if so by how many discs, or else wether it loses. These searches cut
+ * off almost every line not ending the game.
+ *
+ * solved is set when the game is decided, or proven to be a draw. The move is
+ * only valid if found is set as well, as for a lost game the choice of move
+ * is left to the heuristic search. Otherwise the position is not solved at
+ * this depth. search.horizon tells wether the score found is exact.
+ *
+ * A win found is returned even if the search is stopped while trying to
+ * improve it.
+ */
+func (search *Searcher) solveRoot(board *AtaxxBitboard, maximizingPlayer bool, depth int) (move AtaxxMove, score int, solved bool, found bool) {
+	/* Does the player to move win, and by how many discs? */
+	move, score, wins := search.solveAbove(board, maximizingPlayer, maximizingPlayer, depth, ScoreWin)
+	if search.stopped {
+		return
+	}
+	if wins {
+		/* Keep the line of the best win as principal variation */
+		line, length := search.pvTable[0], search.pvLength[0]
+		defer func() { search.pvTable[0], search.pvLength[0] = line, length }()
+
+		for {
+			discs, _, _ := DecodeResultScore(score)
+			if discs < 0 {
+				discs = -discs
+			}
+			better, betterScore, more := search.solveAbove(board, maximizingPlayer, maximizingPlayer, depth, ScoreWin+discs*scorePerDisc)
+			if search.stopped || !more {
+				break
+			}
+			move, score = better, betterScore
+			line, length = search.pvTable[0], search.pvLength[0]
+		}
+		return move, score, true, true
+	}
+	exact := !search.horizon
+
+	/* Does it lose? If not, the move found keeps it from losing. */
+	move, score, survives := search.solveAbove(board, maximizingPlayer, !maximizingPlayer, depth, -ScoreWin-1)
+	if search.stopped {
+		return
+	}
+	if !survives {
+		return PassMove, score, true, false
+	}
+	if exact && !search.horizon {
+		return move, 0, true, true
+	}
+
+	return move, score, false, false
+}
+
+/* Origin of the transposition entries stored at the horizon of a solve */
+func solverOrigin(attacker bool) EntryOrigin {
+	if attacker {
+		return OriginSolveX
+	}
+
+	return OriginSolveO
+}
+
+/* Null window search telling wether the player to move scores more than
+ * threshold, taken from its own point of view. The attacker is the player
+ * trying to prove a win, see solve.
+ */
+func (search *Searcher) solveAbove(board *AtaxxBitboard, maximizingPlayer bool, attacker bool, depth int, threshold int) (move AtaxxMove, score int, above bool) {
+	search.horizon = false
+	if maximizingPlayer {
+		move, score = search.solve(board, maximizingPlayer, attacker, depth, threshold, threshold+1)
+		return move, score, score > threshold
+	}
+
+	move, score = search.solve(board, maximizingPlayer, attacker, depth, -threshold-1, -threshold)
+	return move, score, score < -threshold
+}
+
+/* Alpha-beta search until the end of the game
+ *
+ * Unlike alphaBeta, finished games are the leaves of this search. Every
+ * single fills an empty cell, bringing the end of the game closer, so singles
+ * and forced passes are searched without limit. Jumps do not fill the board
+ * though, so lines of jumps may go on forever, and depth limits the number of
+ * jumps of the attacker instead of the number of plies. A proof has to cover
+ * every move of the defender, so its jumps are not limited, whereas the
+ * attacker mostly finds its way by singles. Lines longer than MaxSearchDepth
+ * plies, e.g. of the defender jumping while the attacker can only pass, are
+ * cut off as well. Positions at the horizon are evaluated heuristically,
+ * which is noted in search.horizon.
+ *
+ * A search not reaching the horizon is exact. Otherwise proven scores still
+ * tell the outcome of the game, as heuristic scores never exceed ScoreWin,
+ * but the winner may be able to win by more discs than found so far.
+ *
+ * Subtrees that did not reach the horizon are stored in the transposition
+ * table as solved, to be used by any later search regardless of depth. Others
+ * are only reused by solves with the same attacker, see EntryOrigin. Entries
+ * of the heuristic search sharing the table hold heuristic scores of a search
+ * counting plies, which could refute a proof, so they only order moves.
+ */
+func (search *Searcher) solve(board *AtaxxBitboard, maximizingPlayer bool, attacker bool, depth int, alpha int, beta int) (bestMove AtaxxMove, bestScore int) {
+	if search.checkStop() {
+		return PassMove, 0
+	}
+	if search.ply < MaxSearchDepth {
+		search.pvLength[search.ply] = 0
+	}
+
+	if board.Finished() {
+		return PassMove, resultScore(board.Score(), search.ply)
+	}
+	if depth < 0 || search.ply >= MaxSearchDepth {
+		search.horizon = true
+		return PassMove, search.evaluate(board)
+	}
+
+	/* Track the horizon of this subtree alone, merging it into the
+	 * parent's once done.
+	 */
+	horizon := search.horizon
+	search.horizon = false
+	defer func() { search.horizon = search.horizon || horizon }()
+
+	var hashMove AtaxxMove
+	var hashFound bool
+	transposition := search.transposition
+	if transposition != nil {
+		key := board.Hash(maximizingPlayer)
+		entry, found := transposition.Load(key)
+		search.hashProbe++
+		if found {
+			search.hashHits++
+			hashMove, hashFound = entry.Move, true
+		}
+		origin := solverOrigin(attacker)
+		if found && (entry.Depth == solvedDepth || entry.Origin == origin && entry.Depth >= depth) {
+			if entry.Depth != solvedDepth {
+				search.horizon = true
+			}
+
+			score := scoreFromTable(entry.Score, search.ply)
+			switch entry.Bound {
+			case BoundExact:
+				search.truncatePV(entry.Move)
+				return entry.Move, score
+			case BoundLower:
+				if score > alpha {
+					alpha = score
+				}
+			case BoundUpper:
+				if score < beta {
+					beta = score
+				}
+			}
+			if alpha >= beta {
+				search.truncatePV(entry.Move)
+				return entry.Move, score
+			}
+		}
+
+		defer func(alpha int, beta int) {
+			if search.stopped {
+				return
+			}
+
+			bound := BoundExact
+			if bestScore <= alpha {
+				bound = BoundUpper
+			} else if bestScore >= beta {
+				bound = BoundLower
+			}
+			entry := TranspositionEntry{bestMove, scoreToTable(bestScore, search.ply), depth, bound, origin}
+			if !search.horizon {
+				entry.Depth, entry.Origin = solvedDepth, OriginSearch
+			}
+			transposition.Store(key, entry)
+		}(alpha, beta)
+	}
+
+	moves := board.Moves(maximizingPlayer)
+	orderSolverMoves(moves, hashMove, hashFound)
+
+	for i, move := range moves {
+		captured := search.makeMove(board, move, maximizingPlayer)
+		childDepth := depth
+		if move.IsDouble() && maximizingPlayer == attacker {
+			childDepth--
+		}
+		_, score := search.solve(board, !maximizingPlayer, attacker, childDepth, alpha, beta)
+		search.unmakeMove(board, move, maximizingPlayer, captured)
+
+		/* Abandon search, returning the best completely searched move */
+		if search.stopped {
+			if i == 0 {
+				return move, 0
+			}
+			return bestMove, bestScore
+		}
+
+		if i == 0 || (maximizingPlayer && score > bestScore) || (!maximizingPlayer && score < bestScore) {
+			bestMove, bestScore = move, score
+			search.updatePV(move)
+		}
+		if maximizingPlayer && bestScore > alpha {
+			alpha = bestScore
+		} else if !maximizingPlayer && bestScore < beta {
+			beta = bestScore
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+
+	return bestMove, bestScore
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestResultScoreRoundTrip(t *testing.T) {
+	for discs := -49; discs <= 49; discs++ {
+		for _, plies := range []int{0, 1, 2, 17, MaxSearchDepth, scorePerDisc - 2, scorePerDisc - 1} {
+			score := resultScore(discs, plies)
+			decodedDiscs, decodedPlies, ok := DecodeResultScore(score)
+			if discs == 0 {
+				if score != 0 || ok {
+					t.Errorf("draw in %d plies: score %d, decoded %t", plies, score, ok)
+				}
+				continue
+			}
+
+			if !ok || decodedDiscs != discs || decodedPlies != plies {
+				t.Errorf("%d discs in %d plies: decoded %d discs in %d plies, %t", discs, plies, decodedDiscs, decodedPlies, ok)
+			}
+			if !ProvenScore(score) || (score > 0) != (discs > 0) {
+				t.Errorf("%d discs in %d plies: score %d", discs, plies, score)
+			}
+
+			/* Storing in the table several plies deep changes nothing */
+			if stored := scoreFromTable(scoreToTable(score, 9), 9); stored != score {
+				t.Errorf("%d discs in %d plies: %d after the table", discs, plies, stored)
+			}
+		}
+	}
+
+	/* Winning by more discs beats winning quicker */
+	if resultScore(2, scorePerDisc-1) <= resultScore(1, 0) || resultScore(-2, scorePerDisc-1) >= resultScore(-1, 0) {
+		t.Error("disc difference not preferred over plies")
+	}
+
+	/* Heuristic scores are never taken for decided games */
+	for _, score := range []int{0, 1, -1, ScoreWin, -ScoreWin, clampHeuristic(ScoreInfinity)} {
+		if _, _, ok := DecodeResultScore(score); ok {
+			t.Errorf("score %d decoded", score)
+		}
+	}
+}
+
+func TestSolveRoot(t *testing.T) {
+	tests := []struct {
+		name   string
+		fen    string
+		moves  []string
+		discs  int
+		plies  int
+		solved bool
+		found  bool
+	}{
+		/* Filling the last cell eliminates O, jumping there wins by less */
+		{"elimination", "xxxxxxx/xxxxxxx/xxxxxxx/xxxxxxx/xxxxxxx/xxxxxxx/xxxxxo1 x 0 1", []string{"g1"}, 49, 1, true, true},
+
+		/* O is walled in and passes, X wins quickest by singles */
+		{"blockade", "oxxxxxx/xxxxxxx/xxxxxxx/xxxxxxx/xxxxxxx/xxxxxxx/xxxxx2 x 0 1", []string{"f1", "g1"}, 47, 3, true, true},
+
+		/* Lost games are solved, but the move is left to the heuristic
+		 * search. Only the winner is known for sure.
+		 */
+		{"blockade of O to move", "oxxxxxx/xxxxxxx/xxxxxxx/xxxxxxx/xxxxxxx/xxxxxxx/xxxxx2 o 0 1", nil, 1, 0, true, false},
+		{"loss", "xxxxxxx/xxxxxxx/xxxxxxx/ooooooo/ooooooo/ooooooo/oooooo1 x 0 1", nil, -1, 0, true, false},
+
+		/* Filling the last cell evens the disc count */
+		{"draw", "-xxxxxx/xxxxxxx/xxxxxxx/ooooooo/ooooooo/oooooxx/ooooox1 x 0 1", []string{"g1"}, 0, 0, true, true},
+	}
+
+	for _, test := range tests {
+		board, state, err := ParseBitboardFEN(test.fen)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		search := NewSearcher(NewBitTranspositionTable(1 << 12))
+		move, score, solved, found := search.solveRoot(board, state.MaximizingPlayer, 4)
+		if solved != test.solved || found != test.found {
+			t.Errorf("%s: solved %t found %t, expected %t %t", test.name, solved, found, test.solved, test.found)
+			continue
+		}
+		if test.moves != nil && !containsString(test.moves, move.String()) {
+			t.Errorf("%s: move %v, expected one of %v", test.name, move, test.moves)
+		}
+
+		discs, plies, _ := DecodeResultScore(score)
+		if !found && (discs > 0) != (test.discs > 0) {
+			t.Errorf("%s: %d discs (score %d), expected the other side to win", test.name, discs, score)
+		} else if found && (discs != test.discs || plies != test.plies) {
+			t.Errorf("%s: %d discs in %d plies (score %d), expected %d in %d", test.name, discs, plies, score, test.discs, test.plies)
+		}
+	}
+}
+
+/* Wether value is one of values */
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+/* Entries of the heuristic search in a shared table must not change the
+ * outcome of a solve, as their depths count plies and their scores are
+ * estimates. Only the number of plies may differ, as the null window searches
+ * take the first win by enough discs.
+ */
+func TestSolveSharedTable(t *testing.T) {
+	fens := []string{
+		"xxxo1oo/xxoooox/xoxxxoo/ooxxoxx/xoooxxo/oxx1xo1/ooxoxoo o 0 40",
+		"xxxxxxx/xxxxxxx/xxx1xxx/ooooooo/ooo1ooo/oooooo1/oooooxx o 0 30",
+		"xxxxxxx/xxxxxxx/xxxxoo1/xxoo1oo/ooooooo/ooo1ooo/oooooo1 x 0 30",
+		"-xxxxxx/xxxxxxx/xxxxxxx/ooooooo/ooooooo/oooooxx/ooooox1 x 0 1",
+	}
+
+	for _, fen := range fens {
+		board, state, err := ParseBitboardFEN(fen)
+		if err != nil {
+			t.Fatalf("%s: %v", fen, err)
+		}
+
+		fresh := NewSearcher(NewBitTranspositionTable(1 << 16))
+		_, score, solved, found := fresh.solveRoot(board, state.MaximizingPlayer, 4)
+		discs, _, _ := DecodeResultScore(score)
+		if !solved {
+			t.Fatalf("%s: not solved", fen)
+		}
+
+		for _, depth := range []int{2, 4, 6} {
+			transposition := NewBitTranspositionTable(1 << 16)
+			heuristic := NewSearcher(transposition)
+			heuristic.Book, heuristic.SolveEmpty = nil, 0
+			heuristic.IterativeDeepening(context.Background(), board, state.MaximizingPlayer, SearchLimits{Depth: depth})
+
+			shared := NewSearcher(transposition)
+			_, sharedScore, sharedSolved, sharedFound := shared.solveRoot(board, state.MaximizingPlayer, 4)
+			sharedDiscs, _, _ := DecodeResultScore(sharedScore)
+			if sharedDiscs != discs || sharedSolved != solved || sharedFound != found {
+				t.Errorf("%s: after a search to depth %d score %d, solved %t found %t, expected %d, %t %t",
+					fen, depth, sharedScore, sharedSolved, sharedFound, score, solved, found)
+			}
+		}
+	}
+}
@@ -0,0 +1,388 @@
+/* Zobrist hashing and the transposition table */
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+/* Zobrist hashing assigns a random 64-bit key to every (player, cell)
+ * combination. The hash of a position is the XOR of the keys of all pieces
+ * on the board, plus a key for the side to move. Blocked cells are hashed as
+ * a third player, so positions from different layouts never collide.
+ *
+ * The keys are generated from a fixed seed, so hashes are identical between
+ * runs and can be stored in files (e.g. opening books).
+ */
+var zobristPieces [3][49]uint64
+var zobristSide uint64
+
+/* Kind of score stored in a transposition entry.
+ *
+ * An alpha-beta search only computes an exact score when the result falls
+ * inside the alpha-beta window. A search failing high only proves the score
+ * to be at least the returned value (lower bound), one failing low only
+ * proves it to be at most the returned value (upper bound).
+ */
+type BoundType uint8
+
+const (
+	BoundNone BoundType = iota
+	BoundExact
+	BoundLower
+	BoundUpper
+)
+
+/* The bound on the negated score, e.g. for the other player */
+func (bound BoundType) negated() BoundType {
+	switch bound {
+	case BoundLower:
+		return BoundUpper
+	case BoundUpper:
+		return BoundLower
+	}
+
+	return bound
+}
+
+/* Search that stored a transposition entry.
+ *
+ * The endgame solver limits the jumps of the player trying to prove a win
+ * rather than the number of plies, see solve. Entries it stores at its
+ * horizon are only meaningful to solves with the same attacker. Solved
+ * entries hold at any depth, so they are stored as OriginSearch.
+ */
+type EntryOrigin uint8
+
+const (
+	OriginSearch EntryOrigin = iota
+	OriginSolveX
+	OriginSolveO
+)
+
+/* A single transposition table entry as seen by the search */
+type TranspositionEntry struct {
+	Move   AtaxxMove
+	Score  int
+	Depth  int
+	Bound  BoundType
+	Origin EntryOrigin
+}
+
+/* Transposition table usage statistics */
+type TranspositionStats struct {
+	Probes int
+	Hits   int
+	Stores int
+}
+
+/* An entry as stored in the table.
+ *
+ * The entry is packed into a single data word, from the least significant
+ * bits up:
+ *
+ *  score  32 bits
+ *  from    8 bits
+ *  to      8 bits
+ *  depth   8 bits
+ *  bound   2 bits
+ *  origin  2 bits
+ *  age     4 bits
+ *
+ * The full hash is kept to detect index collisions, the age is used to
+ * prefer replacing entries left over from previous searches.
+ *
+ * Parallel searches share the table without locking. Instead of the hash
+ * itself the slot holds the hash XOR the data word, so a slot torn by
+ * concurrent writes no longer matches the hash and is simply missed.
+ */
+type ataxxTranspositionSlot struct {
+	check uint64
+	data  uint64
+}
+
+/* Pack an entry into a data word, see ataxxTranspositionSlot */
+func packTransposition(entry TranspositionEntry, age uint8) uint64 {
+	return uint64(uint32(int32(entry.Score))) |
+		uint64(uint8(entry.Move.From))<<32 |
+		uint64(uint8(entry.Move.To))<<40 |
+		uint64(uint8(int8(entry.Depth)))<<48 |
+		uint64(entry.Bound&3)<<56 |
+		uint64(entry.Origin&3)<<58 |
+		uint64(age&15)<<60
+}
+
+/* Unpack a data word, returning the entry and its age */
+func unpackTransposition(data uint64) (TranspositionEntry, uint8) {
+	entry := TranspositionEntry{
+		Move:   AtaxxMove{int8(data >> 32), int8(data >> 40)},
+		Score:  int(int32(uint32(data))),
+		Depth:  int(int8(data >> 48)),
+		Bound:  BoundType(data>>56) & 3,
+		Origin: EntryOrigin(data>>58) & 3,
+	}
+	return entry, uint8(data>>60) & 15
+}
+
+/* Read a slot, returning its hash and data word */
+func (slot *ataxxTranspositionSlot) load() (uint64, uint64) {
+	data := atomic.LoadUint64(&slot.data)
+	return atomic.LoadUint64(&slot.check) ^ data, data
+}
+
+/* Overwrite a slot */
+func (slot *ataxxTranspositionSlot) store(key uint64, data uint64) {
+	atomic.StoreUint64(&slot.check, key^data)
+	atomic.StoreUint64(&slot.data, data)
+}
+
+/* A fixed-size transposition table indexed by Zobrist hash.
+ *
+ * The table is organised in buckets of two slots, using a two-tier
+ * replacement strategy:
+ *  - The first slot is depth-preferred, it is only replaced by searches of
+ *    at least the same depth, or when it stems from an older search.
+ *  - The second slot always receives entries not making it into the first.
+ * This keeps expensive deep results around, while still caching the many
+ * shallow results near the leaves.
+ *
+ * Loading and storing entries is safe for concurrent use, so several
+ * searches can share a table, see Searcher.Threads. NewSearch and Clear must
+ * not be called while searching.
+ *
+ * Works for both AtaxxBoard and AtaxxBitboard.
+ */
+type AtaxxBitTranspositionTable struct {
+	/* Statistics, updated atomically */
+	probes int64
+	hits   int64
+	stores int64
+
+	buckets [][2]ataxxTranspositionSlot
+	mask    uint64
+	age     uint8
+}
+
+/* Small, fast and deterministic pseudo random generator (SplitMix64) */
+func splitMix64(state *uint64) uint64 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+/* Initialize Zobrist keys */
+func initZobrist() {
+	state := uint64(0x41544158585a4f42)
+	for player := 0; player < 3; player++ {
+		for cell := 0; cell < 49; cell++ {
+			zobristPieces[player][cell] = splitMix64(&state)
+		}
+	}
+	zobristSide = splitMix64(&state)
+}
+
+/* Compute the Zobrist key of the pieces and blockers of this position from
+ * scratch. Boards keep it in their hash field, see MakeMove.
+ */
+func (board *AtaxxBitboard) zobristKey() uint64 {
+	var hash uint64
+
+	for pieces := board.maximizingPlayer; pieces != 0; pieces &= pieces - 1 {
+		hash ^= zobristPieces[0][pieces.FirstCell()]
+	}
+	for pieces := board.minimizingPlayer; pieces != 0; pieces &= pieces - 1 {
+		hash ^= zobristPieces[1][pieces.FirstCell()]
+	}
+	for pieces := board.blockers; pieces != 0; pieces &= pieces - 1 {
+		hash ^= zobristPieces[2][pieces.FirstCell()]
+	}
+
+	return hash
+}
+
+/* Change of the Zobrist key by a move, the same for making and unmaking it:
+ * the piece placed on the target, the piece leaving the source of a jump and
+ * the captured pieces changing sides.
+ */
+func zobristMove(move AtaxxMove, maximizingPlayer bool, captured SingleBitboard) uint64 {
+	player := 1
+	if maximizingPlayer {
+		player = 0
+	}
+
+	hash := zobristPieces[player][move.To]
+	if move.IsDouble() {
+		hash ^= zobristPieces[player][move.From]
+	}
+	for pieces := captured; pieces != 0; pieces &= pieces - 1 {
+		cell := pieces.FirstCell()
+		hash ^= zobristPieces[0][cell] ^ zobristPieces[1][cell]
+	}
+
+	return hash
+}
+
+/* Return the Zobrist hash of this position with the given player to move.
+ *
+ * The key of the pieces is kept up to date by MakeMove and UnmakeMove, only
+ * the side to move is added here.
+ */
+func (board *AtaxxBitboard) Hash(maximizingPlayer bool) uint64 {
+	if maximizingPlayer {
+		return board.hash ^ zobristSide
+	}
+
+	return board.hash
+}
+
+/* Compute the Zobrist hash of this position with the given player to move.
+ *
+ * Identical to the hash of the equivalent bitboard.
+ */
+func (board *AtaxxBoard) Hash(maximizingPlayer bool) uint64 {
+	var hash uint64
+
+	for cell := 0; cell < 49; cell++ {
+		switch board[cell/7][cell%7] {
+		case 1:
+			hash ^= zobristPieces[0][cell]
+		case -1:
+			hash ^= zobristPieces[1][cell]
+		case BlockedCell:
+			hash ^= zobristPieces[2][cell]
+		}
+	}
+	if maximizingPlayer {
+		hash ^= zobristSide
+	}
+
+	return hash
+}
+
+/* Hash a board of any of our types */
+func hashGameboard(game MinimaxableGameboard, maximizingPlayer bool) uint64 {
+	switch board := game.(type) {
+	case *AtaxxBitboard:
+		return board.Hash(maximizingPlayer)
+	case *AtaxxBoard:
+		return board.Hash(maximizingPlayer)
+	}
+
+	panic(fmt.Sprintf("transposition: cannot hash %T", game))
+}
+
+/* Build a new table holding (at least) size entries.
+ *
+ * The number of buckets is rounded up to a power of two, so the index can be
+ * computed by masking the hash.
+ */
+func NewBitTranspositionTable(size int) *AtaxxBitTranspositionTable {
+	buckets := 1
+	for buckets*2 < size {
+		buckets *= 2
+	}
+
+	table := AtaxxBitTranspositionTable{}
+	table.buckets = make([][2]ataxxTranspositionSlot, buckets)
+	table.mask = uint64(buckets - 1)
+
+	return &table
+}
+
+/* Load the entry for a position given by its hash, if any */
+func (table *AtaxxBitTranspositionTable) Load(key uint64) (TranspositionEntry, bool) {
+	bucket := &table.buckets[key&table.mask]
+
+	atomic.AddInt64(&table.probes, 1)
+	for i := range bucket {
+		slotKey, data := bucket[i].load()
+		if entry, _ := unpackTransposition(data); entry.Bound != BoundNone && slotKey == key {
+			atomic.AddInt64(&table.hits, 1)
+			return entry, true
+		}
+	}
+
+	return TranspositionEntry{}, false
+}
+
+/* Store the entry for a position, see the type description for the
+ * replacement strategy.
+ */
+func (table *AtaxxBitTranspositionTable) Store(key uint64, entry TranspositionEntry) {
+	bucket := &table.buckets[key&table.mask]
+	data := packTransposition(entry, table.age)
+
+	atomic.AddInt64(&table.stores, 1)
+	preferredKey, preferredData := bucket[0].load()
+	preferred, preferredAge := unpackTransposition(preferredData)
+	if preferredKey == key || preferredAge != table.age&15 || entry.Depth >= preferred.Depth {
+		/* Demote the replaced entry, unless it describes the same position */
+		if preferredKey != key && preferred.Bound != BoundNone {
+			bucket[1].store(preferredKey, preferredData)
+		}
+		bucket[0].store(key, data)
+	} else {
+		bucket[1].store(key, data)
+	}
+}
+
+/* Mark the start of a new search.
+ *
+ * Entries from previous searches remain usable, but are replaced first.
+ */
+func (table *AtaxxBitTranspositionTable) NewSearch() {
+	table.age++
+}
+
+/* Remove all entries and reset statistics */
+func (table *AtaxxBitTranspositionTable) Clear() {
+	for i := range table.buckets {
+		table.buckets[i] = [2]ataxxTranspositionSlot{}
+	}
+	table.age = 0
+	table.probes, table.hits, table.stores = 0, 0, 0
+}
+
+/* Return usage statistics */
+func (table *AtaxxBitTranspositionTable) Stats() TranspositionStats {
+	return TranspositionStats{
+		Probes: int(atomic.LoadInt64(&table.probes)),
+		Hits:   int(atomic.LoadInt64(&table.hits)),
+		Stores: int(atomic.LoadInt64(&table.stores)),
+	}
+}
+
+/* Fraction of probes that found an entry */
+func (stats TranspositionStats) HitRate() float64 {
+	if stats.Probes == 0 {
+		return 0
+	}
+
+	return float64(stats.Hits) / float64(stats.Probes)
+}
+
+/* Fill rate of the table in permille.
+ *
+ * Like most engines we only sample the first thousand slots (or fewer for
+ * tiny tables) to keep this cheap enough to report during search.
+ */
+func (table *AtaxxBitTranspositionTable) Fill() int {
+	buckets := len(table.buckets)
+	if buckets > 500 {
+		buckets = 500
+	}
+
+	used := 0
+	for i := 0; i < buckets; i++ {
+		for j := range table.buckets[i] {
+			_, data := table.buckets[i][j].load()
+			if entry, _ := unpackTransposition(data); entry.Bound != BoundNone {
+				used++
+			}
+		}
+	}
+
+	return used * 1000 / (buckets * 2)
+}
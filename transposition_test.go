@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+)
+
+/* Check the incremental key against one computed from scratch, in every
+ * position up to depth plies away.
+ */
+func checkHash(t *testing.T, board *AtaxxBitboard, maximizingPlayer bool, depth int) {
+	t.Helper()
+	grid := board.ToBoard()
+	if hash, expected := board.Hash(maximizingPlayer), grid.Hash(maximizingPlayer); hash != expected {
+		t.Fatalf("%s: hash %x, expected %x", board.FEN(AtaxxFENState{MaximizingPlayer: maximizingPlayer}), hash, expected)
+	}
+	if depth == 0 {
+		return
+	}
+
+	for _, move := range board.Moves(maximizingPlayer) {
+		captured := board.MakeMove(move, maximizingPlayer)
+		checkHash(t, board, !maximizingPlayer, depth-1)
+		board.UnmakeMove(move, maximizingPlayer, captured)
+	}
+}
+
+func TestIncrementalHash(t *testing.T) {
+	for _, position := range perftPositions {
+		board, state, err := ParseBitboardFEN(position.fen)
+		if err != nil {
+			t.Fatalf("%s: %v", position.fen, err)
+		}
+		original := *board
+
+		checkHash(t, board, state.MaximizingPlayer, 3)
+		if *board != original {
+			t.Errorf("%s: key changed by MakeMove/UnmakeMove", position.fen)
+		}
+	}
+
+	/* The side to move is part of the key */
+	if board := NewBitGame(); board.Hash(true) == board.Hash(false) {
+		t.Error("same key for both sides to move")
+	}
+}
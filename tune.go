@@ -0,0 +1,464 @@
+/* Evaluation tuning from labelled positions (Texel's tuning method) */
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/* Texel's tuning method fits the evaluation to the outcome of real games.
+ *
+ * Every position is labelled with the result of the game it was taken from
+ * (1 for an X win, 0.5 for a draw, 0 for an O win). The evaluation is turned
+ * into an expected result through a sigmoid:
+ *
+ *  expected = 1 / (1 + exp(-k * eval / PieceValue))
+ *
+ * and the weights are chosen to minimize the mean squared difference between
+ * expected and actual results. The scale k is fitted first, with the initial
+ * weights, after which the weights are improved by gradient descent. As the
+ * evaluation is linear in its weights the gradient is cheap to compute from
+ * the features, which are counted once for all positions. The weights are
+ * tuned as real numbers, and rounded at the end. Cells of the piece-square
+ * table are tied to their symmetric counterparts, see pieceSquareOrbit.
+ *
+ * The material weight is kept fixed, as it only scales the evaluation
+ * together with k.
+ */
+
+/* A position along with the result of the game it occurred in */
+type LabelledPosition struct {
+	FEN    string
+	Result GameResult
+}
+
+/* Precomputed position for tuning */
+type tuningSample struct {
+	features [tunableWeights]float64
+	material float64
+	target   float64
+}
+
+/* Read labelled positions, one per line as "<fen>;<result>".
+ *
+ * Empty lines and lines starting with '#' are skipped.
+ */
+func ReadLabelledPositions(in io.Reader) ([]LabelledPosition, error) {
+	positions := make([]LabelledPosition, 0)
+
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, ";")
+		if len(fields) != 2 {
+			return positions, fmt.Errorf("tune: line %d: expected \"<fen>;<result>\"", line)
+		}
+		var position LabelledPosition
+		position.FEN = strings.TrimSpace(fields[0])
+		if err := position.Result.UnmarshalText([]byte(strings.TrimSpace(fields[1]))); err != nil {
+			return positions, fmt.Errorf("tune: line %d: %v", line, err)
+		}
+		if position.Result == ResultNone {
+			return positions, fmt.Errorf("tune: line %d: game has no result", line)
+		}
+		positions = append(positions, position)
+	}
+
+	return positions, scanner.Err()
+}
+
+/* Write labelled positions in the format read by ReadLabelledPositions */
+func WriteLabelledPositions(out io.Writer, positions []LabelledPosition) error {
+	writer := bufio.NewWriter(out)
+	for _, position := range positions {
+		fmt.Fprintf(writer, "%s;%v\n", position.FEN, position.Result)
+	}
+
+	return writer.Flush()
+}
+
+/* Play games of the engine against itself, labelling every position with
+ * the game's result.
+ *
+ * To get varied positions, games start from a random layout and moves are
+ * drawn from the search scores like the weaker difficulty levels do. The
+ * first few plies of every game are skipped, as they are nearly identical
+ * between games.
+ *
+ * concurrency games are played at a time. The first error of any game is
+ * returned once all games have finished.
+ */
+func GenerateLabelledPositions(games int, level Difficulty, concurrency int) ([]LabelledPosition, error) {
+	if concurrency < 1 {
+		return nil, fmt.Errorf("tune: concurrency %d, need at least one game at a time", concurrency)
+	}
+
+	layouts := make([]string, 0, len(StartingLayouts))
+	for _, fen := range StartingLayouts {
+		layouts = append(layouts, fen)
+	}
+	sort.Strings(layouts)
+
+	var mutex sync.Mutex
+	var workers sync.WaitGroup
+	positions := make([]LabelledPosition, 0)
+	var firstErr error
+
+	jobs := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for fen := range jobs {
+				game, err := playTuningGame(fen, level)
+
+				mutex.Lock()
+				positions = append(positions, game...)
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < games; i++ {
+		jobs <- layouts[rand.Intn(len(layouts))]
+	}
+	close(jobs)
+	workers.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return positions, nil
+}
+
+/* Number of plies at the start of every game not used for tuning */
+const tuningSkipPlies = 4
+
+/* Play a single game for GenerateLabelledPositions */
+func playTuningGame(fen string, level Difficulty) ([]LabelledPosition, error) {
+	game, err := NewAtaxxGame(fen)
+	if err != nil {
+		return nil, err
+	}
+	transposition := NewBitTranspositionTable(1 << 16)
+
+	fens := make([]string, 0)
+	for game.Result() == ResultNone {
+		if len(game.Moves) >= tuningSkipPlies {
+			fens = append(fens, game.FEN())
+		}
+
+		transposition.NewSearch()
+		result := level.ChooseMove(context.Background(), NewSearcher(transposition), &game.Board, game.MaximizingPlayer, 0)
+		if err := game.Play(result.Move); err != nil {
+			return nil, fmt.Errorf("tune: %s: %w", game.FEN(), err)
+		}
+	}
+
+	positions := make([]LabelledPosition, len(fens))
+	for i, fen := range fens {
+		positions[i] = LabelledPosition{fen, game.Result()}
+	}
+
+	return positions, nil
+}
+
+/* Compute features and targets for all positions, skipping finished games
+ * as their evaluation does not depend on the weights.
+ */
+func tuningSamples(positions []LabelledPosition) ([]tuningSample, error) {
+	samples := make([]tuningSample, 0, len(positions))
+	for _, position := range positions {
+		board, _, err := ParseBitboardFEN(position.FEN)
+		if err != nil {
+			return nil, err
+		}
+		if board.Finished() {
+			continue
+		}
+
+		target := 0.5
+		switch position.Result {
+		case ResultXWins:
+			target = 1
+		case ResultOWins:
+			target = 0
+		}
+		features := board.Features()
+		samples = append(samples, tuningSample{features.tunable(), float64(features.Material), target})
+	}
+
+	return samples, nil
+}
+
+/* Number of tuned weights: mobility, frontier, safe and the piece-square
+ * table. Material is fixed.
+ */
+const tunableWeights = 3 + 49
+
+/* The tuned weights, in the order of EvalFeatures.tunable */
+func (weights *EvalWeights) tunable() [tunableWeights]*int {
+	var parameters [tunableWeights]*int
+	parameters[0], parameters[1], parameters[2] = &weights.Mobility, &weights.Frontier, &weights.Safe
+	for cell := range weights.PieceSquare {
+		parameters[3+cell] = &weights.PieceSquare[cell]
+	}
+
+	return parameters
+}
+
+/* The features of the tuned weights, in the order of EvalWeights.tunable */
+func (features *EvalFeatures) tunable() [tunableWeights]float64 {
+	var values [tunableWeights]float64
+	values[0], values[1], values[2] = float64(features.Mobility), float64(features.Frontier), float64(features.Safe)
+	for cell, count := range features.PieceSquare {
+		values[3+cell] = float64(count)
+	}
+
+	return values
+}
+
+/* Cells equivalent to the given one for the piece-square table.
+ *
+ * X starts in the a7 and g1 corners, and O in the mirrored ones, which
+ * makes the table symmetric to the a7-g1 diagonal and the other diagonal,
+ * as are all starting layouts. Tying equivalent cells together quarters
+ * the number of weights to fit, making the table far less noisy.
+ */
+func pieceSquareOrbit(cell int) [4]int {
+	x, y := cell%7, cell/7
+	return [4]int{y*7 + x, (6-y)*7 + 6 - x, x*7 + y, (6-x)*7 + 6 - y}
+}
+
+/* Average the piece-square part of tuned values over equivalent cells */
+func symmetrizePieceSquare(values *[tunableWeights]float64) {
+	var average [49]float64
+	for cell := range average {
+		for _, equivalent := range pieceSquareOrbit(cell) {
+			average[cell] += values[3+equivalent] / 4
+		}
+	}
+	for cell, value := range average {
+		values[3+cell] = value
+	}
+}
+
+/* Expected result of a sample, for the given material and tuned weights */
+func (sample *tuningSample) expected(material float64, parameters *[tunableWeights]float64, k float64) float64 {
+	score := material * sample.material
+	for i, value := range sample.features {
+		score += parameters[i] * value
+	}
+
+	return 1 / (1 + math.Exp(-k*score/PieceValue))
+}
+
+/* Mean squared error between expected and actual results */
+func tuningError(samples []tuningSample, material float64, parameters *[tunableWeights]float64, k float64) float64 {
+	total := 0.0
+	for i := range samples {
+		diff := samples[i].target - samples[i].expected(material, parameters, k)
+		total += diff * diff
+	}
+
+	return total / float64(len(samples))
+}
+
+/* Weights as real numbers, for tuning */
+func tuningParameters(weights *EvalWeights) (parameters [tunableWeights]float64) {
+	for i, weight := range weights.tunable() {
+		parameters[i] = float64(*weight)
+	}
+
+	return parameters
+}
+
+/* Find the sigmoid scale best matching the given weights, by repeatedly
+ * narrowing down the interval around the best value.
+ */
+func fitTuningScale(samples []tuningSample, weights *EvalWeights) float64 {
+	material, parameters := float64(weights.Material), tuningParameters(weights)
+
+	best, step := 1.0, 0.5
+	bestError := tuningError(samples, material, &parameters, best)
+	for i := 0; i < 40; i++ {
+		improved := false
+		for _, k := range []float64{best - step, best + step} {
+			if k <= 0 {
+				continue
+			}
+			if err := tuningError(samples, material, &parameters, k); err < bestError {
+				best, bestError, improved = k, err, true
+			}
+		}
+		if !improved {
+			step /= 2
+		}
+	}
+
+	return best
+}
+
+/* Improve weights by the given number of gradient descent steps. Adam is
+ * used to adapt the step size per weight, so every step changes a weight by
+ * about rate at most, whatever the scale of its feature. Progress is
+ * reported to log every 100 steps.
+ */
+func TuneWeights(samples []tuningSample, initial EvalWeights, k float64, iterations int, rate float64, log io.Writer) EvalWeights {
+	const beta1, beta2, epsilon = 0.9, 0.999, 1e-8
+
+	material, parameters := float64(initial.Material), tuningParameters(&initial)
+	symmetrizePieceSquare(&parameters)
+	fmt.Fprintf(log, "iteration 0 error %.6f\n", tuningError(samples, material, &parameters, k))
+
+	var moment, velocity [tunableWeights]float64
+	for iteration := 1; iteration <= iterations; iteration++ {
+		/* d/dw (target - sigmoid)^2 = -2 (target - sigmoid) sigmoid' feature */
+		var gradient [tunableWeights]float64
+		for i := range samples {
+			expected := samples[i].expected(material, &parameters, k)
+			slope := (expected - samples[i].target) * expected * (1 - expected)
+			for j, value := range samples[i].features {
+				gradient[j] += slope * value
+			}
+		}
+
+		symmetrizePieceSquare(&gradient)
+
+		scale := 2 * k / PieceValue / float64(len(samples))
+		correction1 := 1 - math.Pow(beta1, float64(iteration))
+		correction2 := 1 - math.Pow(beta2, float64(iteration))
+		for j := range parameters {
+			gradient[j] *= scale
+			moment[j] = beta1*moment[j] + (1-beta1)*gradient[j]
+			velocity[j] = beta2*velocity[j] + (1-beta2)*gradient[j]*gradient[j]
+			parameters[j] -= rate * (moment[j] / correction1) / (math.Sqrt(velocity[j]/correction2) + epsilon)
+		}
+
+		if iteration%100 == 0 || iteration == iterations {
+			fmt.Fprintf(log, "iteration %d error %.6f\n", iteration, tuningError(samples, material, &parameters, k))
+		}
+	}
+
+	weights := initial
+	for i, weight := range weights.tunable() {
+		*weight = int(math.Round(parameters[i]))
+	}
+
+	return weights
+}
+
+/* Run the tune subcommand
+ *
+ * tune [-positions FILE] [-generate GAMES] [-save FILE] [-level LEVEL]
+ *      [-concurrency N] [-eval FILE] [-iterations N] [-rate R] [-out FILE]
+ */
+func RunTune(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("tune", flag.ContinueOnError)
+	positionsFile := flags.String("positions", "", "read labelled positions from file")
+	generate := flags.Int("generate", 0, "generate labelled positions from this many self-play games")
+	saveFile := flags.String("save", "", "write the generated positions to file")
+	levelName := flags.String("level", "easy", "difficulty level used for generating games")
+	concurrency := flags.Int("concurrency", runtime.NumCPU(), "number of games generated in parallel")
+	evalFile := flags.String("eval", "", "initial weights, defaults to the built-in weights")
+	iterations := flags.Int("iterations", 1000, "number of gradient descent steps")
+	rate := flags.Float64("rate", 1, "learning rate, the largest change of a weight per step")
+	outFile := flags.String("out", "", "write the tuned weights to file instead of standard output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *positionsFile == "" && *generate <= 0 {
+		return errors.New("tune: need -positions or -generate")
+	}
+	if *concurrency < 1 {
+		return errors.New("tune: -concurrency must be at least 1")
+	}
+
+	weights := DefaultEvalWeights
+	if *evalFile != "" {
+		var err error
+		if weights, err = LoadEvalWeights(*evalFile); err != nil {
+			return err
+		}
+	}
+	SetEvalWeights(weights)
+
+	/* Collect labelled positions */
+	positions := make([]LabelledPosition, 0)
+	if *positionsFile != "" {
+		file, err := os.Open(*positionsFile)
+		if err != nil {
+			return err
+		}
+		read, err := ReadLabelledPositions(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		positions = append(positions, read...)
+	}
+	if *generate > 0 {
+		level, err := ParseDifficulty(*levelName)
+		if err != nil {
+			return err
+		}
+		if level.Depth == 0 {
+			return errors.New("tune: generating games requires a fixed depth level")
+		}
+		generated, err := GenerateLabelledPositions(*generate, level, *concurrency)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "generated %d positions from %d games\n", len(generated), *generate)
+
+		if *saveFile != "" {
+			file, err := os.Create(*saveFile)
+			if err != nil {
+				return err
+			}
+			err = WriteLabelledPositions(file, generated)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+		positions = append(positions, generated...)
+	}
+
+	samples, err := tuningSamples(positions)
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return errors.New("tune: no positions to tune on")
+	}
+
+	/* Fit the sigmoid, then the weights */
+	k := fitTuningScale(samples, &weights)
+	fmt.Fprintf(os.Stderr, "tuning %d positions, k %.4f\n", len(samples), k)
+	weights = TuneWeights(samples, weights, k, *iterations, *rate, os.Stderr)
+
+	if *outFile != "" {
+		return weights.Save(*outFile)
+	}
+	return weights.Write(out)
+}
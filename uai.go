@@ -0,0 +1,424 @@
+/* Universal Ataxx Interface (UAI) engine mode */
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* UAI is the Ataxx counterpart of the UCI protocol used by chess engines.
+ *
+ * The GUI (or match runner) talks to the engine over stdin/stdout using
+ * simple line based commands:
+ *
+ *  uai                                 -> id name/author, uaiok
+ *  isready                             -> readyok
+ *  setoption name EvalFile value <f>   -> load evaluation weights
+ *  setoption name BookFile value <f>   -> load opening book
+ *  setoption name SolveEmpty value <n> -> solve endgames with n empty cells
+ *  setoption name Threads value <n>    -> search using n threads
+ *  setoption name PVS value <bool>     -> switch search features, also
+ *                                         OrderMoves, Aspiration and LMR
+ *  uainewgame                          -> clear hash tables
+ *  position startpos [moves ...]       -> setup position
+ *  position fen <fen> [moves ...]      -> setup position
+ *  go depth/movetime/wtime/btime/...   -> start searching
+ *  stop                                -> stop searching asap
+ *  quit                                -> terminate engine
+ *
+ * While searching the engine reports its progress using "info" lines, and
+ * finishes every search with a single "bestmove" line. It keeps reading
+ * commands meanwhile: isready is answered at once, commands changing the
+ * position or options stop the search first. Decided games are reported as
+ * "score mate N", the game ending within N moves, negative when the engine
+ * loses.
+ *
+ * As with other Ataxx GUIs, X is Black: btime and binc are the clock of X,
+ * wtime and winc the clock of O.
+ */
+
+/* Largest number of threads accepted by the Threads option */
+const uaiMaxThreads = 256
+
+/* Name reported to the GUI */
+const uaiEngineName = "go-ataxx"
+const uaiEngineAuthor = "meridion"
+
+/* Limits passed by the GUI to the "go" command */
+type uaiLimits struct {
+	depth    int
+	moveTime time.Duration
+	time     [2]time.Duration
+	inc      [2]time.Duration
+	infinite bool
+}
+
+/* Engine state for a single UAI session */
+type uaiEngine struct {
+	/* Output is shared between the command loop and the search goroutine */
+	out      *bufio.Writer
+	outMutex sync.Mutex
+
+	/* Current position */
+	board            AtaxxBitboard
+	maximizingPlayer bool
+
+	transposition *AtaxxBitTranspositionTable
+	weights       EvalWeights
+	book          *OpeningBook
+	solveEmpty    int
+	threads       int
+	features      SearchFeatures
+
+	/* Search goroutine bookkeeping */
+	searching sync.WaitGroup
+	cancel    context.CancelFunc
+}
+
+/* Run the UAI command loop until "quit" is received or input is closed */
+func RunUAI(in io.Reader, out io.Writer) {
+	engine := uaiEngine{}
+	engine.out = bufio.NewWriter(out)
+	engine.board = *NewBitGame()
+	engine.maximizingPlayer = true
+	engine.transposition = NewBitTranspositionTable(1 << 20)
+	engine.weights = engineEvalWeights
+	engine.book = engineBook
+	engine.solveEmpty = DefaultSolveEmpty
+	engine.threads = engineThreads
+	engine.features = DefaultSearchFeatures
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "uai":
+			engine.send("id name " + uaiEngineName)
+			engine.send("id author " + uaiEngineAuthor)
+			engine.send("option name EvalFile type string default <empty>")
+			engine.send("option name BookFile type string default <empty>")
+			engine.send(fmt.Sprintf("option name SolveEmpty type spin default %d min 0 max 49", DefaultSolveEmpty))
+			engine.send(fmt.Sprintf("option name Threads type spin default %d min 1 max %d", engineThreads, uaiMaxThreads))
+			for _, feature := range uaiFeatureOptions(&engine.features) {
+				engine.send(fmt.Sprintf("option name %s type check default %t", feature.name, *feature.enabled))
+			}
+			engine.send("uaiok")
+
+		case "isready":
+			engine.send("readyok")
+
+		case "setoption":
+			engine.stopSearch()
+			if err := engine.setOption(fields[1:]); err != nil {
+				engine.send("info string " + err.Error())
+			}
+
+		case "uainewgame":
+			engine.stopSearch()
+			engine.transposition.Clear()
+
+		case "position":
+			engine.stopSearch()
+			if err := engine.position(fields[1:]); err != nil {
+				engine.send("info string " + err.Error())
+			}
+
+		case "go":
+			engine.stopSearch()
+			limits, err := parseUAILimits(fields[1:])
+			if err != nil {
+				engine.send("info string " + err.Error())
+				break
+			}
+			engine.transposition.NewSearch()
+			ctx, cancel := context.WithCancel(context.Background())
+			engine.cancel = cancel
+			engine.searching.Add(1)
+			go engine.search(ctx, limits)
+
+		case "stop":
+			engine.stopSearch()
+
+		case "quit":
+			engine.stopSearch()
+			return
+
+		default:
+			engine.send("info string unknown command " + fields[0])
+		}
+	}
+
+	/* Input closed, finish any running search before leaving */
+	engine.stopSearch()
+}
+
+/* Handle "setoption name <name> value <value>" */
+func (engine *uaiEngine) setOption(args []string) error {
+	if len(args) < 2 || args[0] != "name" {
+		return errors.New("setoption: expected name")
+	}
+
+	/* Option values may contain spaces */
+	name, value := args[1], ""
+	for i := 2; i < len(args); i++ {
+		if args[i] == "value" {
+			value = strings.Join(args[i+1:], " ")
+			break
+		}
+	}
+
+	switch name {
+	case "EvalFile":
+		if value == "" || value == "<empty>" {
+			engine.weights = DefaultEvalWeights
+			return nil
+		}
+		weights, err := LoadEvalWeights(value)
+		if err != nil {
+			return err
+		}
+		engine.weights = weights
+		return nil
+
+	case "BookFile":
+		if value == "" || value == "<empty>" {
+			engine.book = nil
+			return nil
+		}
+		book, err := LoadOpeningBook(value)
+		if err != nil {
+			return err
+		}
+		engine.book = book
+		return nil
+
+	case "SolveEmpty":
+		empty, err := strconv.Atoi(value)
+		if err != nil || empty < 0 || empty > 49 {
+			return fmt.Errorf("setoption: invalid SolveEmpty %q", value)
+		}
+		engine.solveEmpty = empty
+		return nil
+
+	case "Threads":
+		threads, err := strconv.Atoi(value)
+		if err != nil || threads < 1 || threads > uaiMaxThreads {
+			return fmt.Errorf("setoption: invalid Threads %q", value)
+		}
+		engine.threads = threads
+		return nil
+	}
+
+	for _, feature := range uaiFeatureOptions(&engine.features) {
+		if name == feature.name {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("setoption: invalid %s %q", name, value)
+			}
+			*feature.enabled = enabled
+			return nil
+		}
+	}
+
+	return fmt.Errorf("setoption: unknown option %q", name)
+}
+
+/* A search feature as check option */
+type uaiFeatureOption struct {
+	name    string
+	enabled *bool
+}
+
+/* Options switching search features, see SearchFeatures */
+func uaiFeatureOptions(features *SearchFeatures) []uaiFeatureOption {
+	return []uaiFeatureOption{
+		{"OrderMoves", &features.OrderMoves},
+		{"PVS", &features.PVS},
+		{"Aspiration", &features.Aspiration},
+		{"LMR", &features.LMR},
+	}
+}
+
+/* Interrupt a running search and wait for it to report its move */
+func (engine *uaiEngine) stopSearch() {
+	if engine.cancel != nil {
+		engine.cancel()
+	}
+	engine.searching.Wait()
+}
+
+/* Write a single line to the GUI */
+func (engine *uaiEngine) send(line string) {
+	engine.outMutex.Lock()
+	defer engine.outMutex.Unlock()
+
+	engine.out.WriteString(line)
+	engine.out.WriteString("\n")
+	engine.out.Flush()
+}
+
+/* Handle the "position" command
+ *
+ * position startpos [moves m1 m2 ...]
+ * position fen <fen> [moves m1 m2 ...]
+ */
+func (engine *uaiEngine) position(args []string) error {
+	if len(args) == 0 {
+		return errors.New("position: missing arguments")
+	}
+
+	var board AtaxxBitboard
+	var maximizingPlayer bool
+
+	/* Split off move list */
+	moves := []string{}
+	for i, arg := range args {
+		if arg == "moves" {
+			moves = args[i+1:]
+			args = args[:i]
+			break
+		}
+	}
+
+	switch args[0] {
+	case "startpos":
+		board = *NewBitGame()
+		maximizingPlayer = true
+
+	case "fen":
+		fenBoard, state, err := ParseBitboardFEN(strings.Join(args[1:], " "))
+		if err != nil {
+			return err
+		}
+		board = *fenBoard
+		maximizingPlayer = state.MaximizingPlayer
+
+	default:
+		return fmt.Errorf("position: unknown argument %q", args[0])
+	}
+
+	/* Replay move list */
+	for _, notation := range moves {
+		move, err := ParseLegalMove(&board, maximizingPlayer, notation)
+		if err != nil {
+			return err
+		}
+		board.MakeMove(move, maximizingPlayer)
+		maximizingPlayer = !maximizingPlayer
+	}
+
+	engine.board = board
+	engine.maximizingPlayer = maximizingPlayer
+
+	return nil
+}
+
+/* Parse the arguments of the "go" command */
+func parseUAILimits(args []string) (limits uaiLimits, err error) {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "infinite" {
+			limits.infinite = true
+			continue
+		}
+
+		/* All other arguments take a single integer value */
+		if i+1 >= len(args) {
+			return limits, fmt.Errorf("go: missing value for %q", args[i])
+		}
+		value, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			return limits, fmt.Errorf("go: invalid value for %q: %v", args[i], err)
+		}
+		ms := time.Duration(value) * time.Millisecond
+
+		switch args[i] {
+		case "depth":
+			limits.depth = value
+		case "movetime":
+			limits.moveTime = ms
+		case "btime":
+			limits.time[1] = ms
+		case "wtime":
+			limits.time[0] = ms
+		case "binc":
+			limits.inc[1] = ms
+		case "winc":
+			limits.inc[0] = ms
+		default:
+			/* Ignore unsupported limits such as movestogo, but skip their value */
+		}
+		i++
+	}
+
+	return limits, nil
+}
+
+/* Format a score from the point of view of the side to move for an "info"
+ * line: "cp N", or "mate N" for decided games.
+ */
+func uaiScore(score int) string {
+	discs, plies, ok := DecodeResultScore(score)
+	if !ok {
+		return "cp " + strconv.Itoa(score)
+	}
+
+	moves := (plies + 1) / 2
+	if discs < 0 {
+		moves = -moves
+	}
+	return "mate " + strconv.Itoa(moves)
+}
+
+/* Convert the GUI limits to search limits for the player to move */
+func (limits *uaiLimits) searchLimits(maximizingPlayer bool) SearchLimits {
+	side := boolIndex(maximizingPlayer)
+	return SearchLimits{
+		Depth:     limits.depth,
+		MoveTime:  limits.moveTime,
+		Time:      limits.time[side],
+		Increment: limits.inc[side],
+	}
+}
+
+/* Search the current position and report the best move found */
+func (engine *uaiEngine) search(ctx context.Context, limits uaiLimits) {
+	defer engine.searching.Done()
+
+	board := engine.board
+	searcher := NewSearcher(engine.transposition)
+	searcher.Weights = &engine.weights
+	searcher.Book = engine.book
+	searcher.SolveEmpty = engine.solveEmpty
+	searcher.Threads = engine.threads
+	searcher.SearchFeatures = engine.features
+	searcher.OnInfo = func(info SearchInfo) {
+		/* Scores are reported from the point of view of the side to move */
+		score := info.Score
+		if !engine.maximizingPlayer {
+			score = -score
+		}
+		engine.send(fmt.Sprintf("info depth %d seldepth %d score %s nodes %d nps %d time %d hashfull %d pv %s",
+			info.Depth, info.SelDepth, uaiScore(score), info.Nodes, info.NPS, info.Time.Milliseconds(),
+			engine.transposition.Fill(), info.PVString()))
+	}
+
+	result := searcher.IterativeDeepening(ctx, &board, engine.maximizingPlayer, limits.searchLimits(engine.maximizingPlayer))
+
+	/* An infinite search may only report its move after being stopped */
+	if limits.infinite {
+		<-ctx.Done()
+	}
+
+	engine.send("bestmove " + result.Move.String())
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+/* The engine keeps reading commands during an infinite search: isready is
+ * answered at once, a new position stops the search.
+ */
+func TestUAIInfiniteSearch(t *testing.T) {
+	in, commands := io.Pipe()
+	responses, out := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		RunUAI(in, out)
+		out.Close()
+		close(done)
+	}()
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(responses)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	/* Wait for a line starting with prefix, skipping all others */
+	expect := func(prefix string) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatalf("output closed, expected %s", prefix)
+				}
+				if strings.HasPrefix(line, prefix) {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("no %s within 5s", prefix)
+			}
+		}
+	}
+	send := func(command string) {
+		io.WriteString(commands, command+"\n")
+	}
+
+	send("position startpos")
+	send("go infinite")
+	expect("info depth")
+	send("isready")
+	expect("readyok")
+
+	send("position startpos moves b6")
+	expect("bestmove")
+	send("go depth 1")
+	expect("bestmove")
+
+	send("quit")
+	for range lines {
+	}
+	<-done
+}
@@ -0,0 +1,280 @@
+/* Minimal WebSocket (RFC 6455) server implementation */
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* Just enough of the WebSocket protocol to push game events to browsers and
+ * receive small commands from them:
+ *  - The opening handshake, upgrading a regular HTTP request.
+ *  - Text and binary messages, including fragmented ones.
+ *  - Ping/pong and the closing handshake.
+ * Extensions (compression) and subprotocols are not supported.
+ */
+
+/* Magic value for computing the handshake response, see RFC 6455 1.3 */
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+/* Largest message we accept from clients */
+const webSocketMaxMessage = 64 * 1024
+
+/* Time allowed for writing a single message */
+const webSocketWriteTimeout = 5 * time.Second
+
+/* Frame opcodes */
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+)
+
+/* Returned by ReadMessage for invalid frames */
+var ErrWebSocketProtocol = errors.New("websocket: protocol error")
+
+/* A server side WebSocket connection.
+ *
+ * Reading must be done from a single goroutine, writing is safe from any
+ * number of goroutines.
+ */
+type WebSocket struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	writeMutex sync.Mutex
+	closed     bool
+}
+
+/* Perform the opening handshake, taking over the connection of the request.
+ *
+ * On failure an error response has already been sent.
+ */
+func UpgradeWebSocket(w http.ResponseWriter, r *http.Request) (*WebSocket, error) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket: upgrade required", http.StatusUpgradeRequired)
+		return nil, errors.New("websocket: not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "websocket: unsupported version", http.StatusBadRequest)
+		return nil, errors.New("websocket: unsupported version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "websocket: missing key", http.StatusBadRequest)
+		return nil, errors.New("websocket: missing key")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket: cannot hijack connection", http.StatusInternalServerError)
+		return nil, errors.New("websocket: cannot hijack connection")
+	}
+	conn, buffers, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	/* Prove we understood the handshake by hashing the key */
+	hash := sha1.Sum([]byte(key + webSocketGUID))
+	accept := base64.StdEncoding.EncodeToString(hash[:])
+
+	buffers.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	buffers.WriteString("Upgrade: websocket\r\n")
+	buffers.WriteString("Connection: Upgrade\r\n")
+	buffers.WriteString("Sec-WebSocket-Accept: " + accept + "\r\n\r\n")
+	if err := buffers.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &WebSocket{conn: conn, reader: buffers.Reader}, nil
+}
+
+/* Check wether a comma separated header contains the given token */
+func headerContains(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+/* Read the next data message, answering control frames on the way.
+ *
+ * Returns io.EOF once the client closed the connection.
+ */
+func (ws *WebSocket) ReadMessage() (opcode byte, message []byte, err error) {
+	for {
+		fin, frameOpcode, payload, err := ws.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch frameOpcode {
+		case wsOpPing:
+			ws.writeFrame(wsOpPong, payload)
+
+		case wsOpPong:
+			/* Unsolicited pongs are allowed, and ignored */
+
+		case wsOpClose:
+			ws.writeFrame(wsOpClose, payload)
+			ws.conn.Close()
+			return 0, nil, io.EOF
+
+		case wsOpText, wsOpBinary, wsOpContinuation:
+			if frameOpcode == wsOpContinuation && opcode == 0 {
+				return 0, nil, ErrWebSocketProtocol
+			}
+			if frameOpcode != wsOpContinuation {
+				if opcode != 0 {
+					return 0, nil, ErrWebSocketProtocol
+				}
+				opcode = frameOpcode
+			}
+			if len(message)+len(payload) > webSocketMaxMessage {
+				return 0, nil, fmt.Errorf("websocket: message exceeds %d bytes", webSocketMaxMessage)
+			}
+			message = append(message, payload...)
+			if fin {
+				return opcode, message, nil
+			}
+
+		default:
+			return 0, nil, ErrWebSocketProtocol
+		}
+	}
+}
+
+/* Read and unmask a single frame */
+func (ws *WebSocket) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(ws.reader, header[:]); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+
+	/* Reserved bits are only used by extensions, clients must mask */
+	if header[0]&0x70 != 0 || !masked {
+		err = ErrWebSocketProtocol
+		return
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err = io.ReadFull(ws.reader, extended[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err = io.ReadFull(ws.reader, extended[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+
+	/* Control frames are short and never fragmented */
+	if opcode >= wsOpClose && (!fin || length > 125) {
+		err = ErrWebSocketProtocol
+		return
+	}
+	if length > webSocketMaxMessage {
+		err = fmt.Errorf("websocket: frame exceeds %d bytes", webSocketMaxMessage)
+		return
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(ws.reader, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(ws.reader, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i&3]
+	}
+
+	return
+}
+
+/* Write a single unfragmented frame, servers never mask */
+func (ws *WebSocket) writeFrame(opcode byte, payload []byte) error {
+	ws.writeMutex.Lock()
+	defer ws.writeMutex.Unlock()
+
+	if ws.closed {
+		return net.ErrClosed
+	}
+
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	frame = append(frame, payload...)
+
+	ws.conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+	_, err := ws.conn.Write(frame)
+	if opcode == wsOpClose {
+		ws.closed = true
+	}
+
+	return err
+}
+
+/* Send a text message */
+func (ws *WebSocket) WriteText(message []byte) error {
+	return ws.writeFrame(wsOpText, message)
+}
+
+/* Send a value as JSON text message */
+func (ws *WebSocket) WriteJSON(value interface{}) error {
+	message, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return ws.WriteText(message)
+}
+
+/* Close the connection, telling the client we're going away */
+func (ws *WebSocket) Close() error {
+	/* Status 1000, normal closure */
+	ws.writeFrame(wsOpClose, []byte{0x03, 0xe8})
+	return ws.conn.Close()
+}
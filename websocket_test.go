@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+/* A frame as sent by clients, masked unless told otherwise. Lengths use the
+ * given encoding: 7 bits, 16 bits (126) or 64 bits (127).
+ */
+func clientFrame(fin bool, opcode byte, payload []byte, encoding int, masked bool) []byte {
+	var frame []byte
+	if fin {
+		opcode |= 0x80
+	}
+	frame = append(frame, opcode)
+
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	switch encoding {
+	case 126:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	case 127:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	default:
+		frame = append(frame, maskBit|byte(len(payload)))
+	}
+
+	if !masked {
+		return append(frame, payload...)
+	}
+	mask := [4]byte{0x37, 0xfa, 0x21, 0x3d}
+	frame = append(frame, mask[:]...)
+	for i, c := range payload {
+		frame = append(frame, c^mask[i&3])
+	}
+	return frame
+}
+
+/* Read a single unmasked frame as sent by the server */
+func readServerFrame(in io.Reader) (header byte, payload []byte, err error) {
+	var start [2]byte
+	if _, err = io.ReadFull(in, start[:]); err != nil {
+		return
+	}
+	if start[1]&0x80 != 0 {
+		return 0, nil, errors.New("masked server frame")
+	}
+
+	length := uint64(start[1])
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err = io.ReadFull(in, extended[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err = io.ReadFull(in, extended[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+
+	payload = make([]byte, length)
+	_, err = io.ReadFull(in, payload)
+	return start[0], payload, err
+}
+
+/* Server and client end of an in-memory connection */
+func webSocketPipe() (*WebSocket, net.Conn) {
+	server, client := net.Pipe()
+	return &WebSocket{conn: server, reader: bufio.NewReader(server)}, client
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := UpgradeWebSocket(w, r)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		/* Echo a single message */
+		if _, message, err := ws.ReadMessage(); err == nil {
+			ws.WriteText(message)
+		}
+	}))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	/* Example of RFC 6455 1.3 */
+	io.WriteString(conn, "GET /chat HTTP/1.1\r\nHost: server.example.com\r\n"+
+		"Upgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status %d, expected 101", response.StatusCode)
+	}
+	if accept := response.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept %q", accept)
+	}
+
+	conn.Write(clientFrame(true, wsOpText, []byte("hello"), 0, true))
+	header, payload, err := readServerFrame(reader)
+	if err != nil || header != 0x80|wsOpText || string(payload) != "hello" {
+		t.Errorf("echo %#x %q, %v", header, payload, err)
+	}
+}
+
+func TestWebSocketHandshakeRejected(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		status int
+	}{
+		{http.Header{}, http.StatusUpgradeRequired},
+		{http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}, "Sec-Websocket-Version": {"8"}}, http.StatusBadRequest},
+		{http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}, "Sec-Websocket-Version": {"13"}}, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header = test.header
+		recorder := httptest.NewRecorder()
+		if _, err := UpgradeWebSocket(recorder, request); err == nil || recorder.Code != test.status {
+			t.Errorf("%v: status %d, %v, expected %d", test.header, recorder.Code, err, test.status)
+		}
+	}
+}
+
+func TestWebSocketReadMessage(t *testing.T) {
+	long := bytes.Repeat([]byte("ataxx "), 200)
+	tests := []struct {
+		name    string
+		frames  [][]byte
+		opcode  byte
+		message []byte
+		err     bool
+	}{
+		{"text", [][]byte{clientFrame(true, wsOpText, []byte("hello"), 0, true)}, wsOpText, []byte("hello"), false},
+		{"empty", [][]byte{clientFrame(true, wsOpBinary, nil, 0, true)}, wsOpBinary, []byte{}, false},
+		{"16 bit length", [][]byte{clientFrame(true, wsOpBinary, long, 126, true)}, wsOpBinary, long, false},
+		{"64 bit length", [][]byte{clientFrame(true, wsOpText, long, 127, true)}, wsOpText, long, false},
+		{"continuation", [][]byte{
+			clientFrame(false, wsOpText, []byte("hel"), 0, true),
+			clientFrame(false, wsOpContinuation, []byte("l"), 0, true),
+			clientFrame(true, wsOpContinuation, []byte("o"), 0, true),
+		}, wsOpText, []byte("hello"), false},
+		{"pong between fragments", [][]byte{
+			clientFrame(false, wsOpText, []byte("hel"), 0, true),
+			clientFrame(true, wsOpPong, []byte("unsolicited"), 0, true),
+			clientFrame(true, wsOpContinuation, []byte("lo"), 0, true),
+		}, wsOpText, []byte("hello"), false},
+		{"unmasked", [][]byte{clientFrame(true, wsOpText, []byte("hello"), 0, false)}, 0, nil, true},
+		{"reserved bits", [][]byte{append([]byte{0xc1}, clientFrame(true, wsOpText, nil, 0, true)[1:]...)}, 0, nil, true},
+		{"lone continuation", [][]byte{clientFrame(true, wsOpContinuation, []byte("lo"), 0, true)}, 0, nil, true},
+		{"interleaved message", [][]byte{
+			clientFrame(false, wsOpText, []byte("hel"), 0, true),
+			clientFrame(true, wsOpText, []byte("lo"), 0, true),
+		}, 0, nil, true},
+		{"fragmented control frame", [][]byte{clientFrame(false, wsOpPing, nil, 0, true)}, 0, nil, true},
+		{"too long", [][]byte{clientFrame(true, wsOpBinary, make([]byte, webSocketMaxMessage+1), 127, true)}, 0, nil, true},
+		{"unknown opcode", [][]byte{clientFrame(true, 0x3, nil, 0, true)}, 0, nil, true},
+	}
+
+	for _, test := range tests {
+		ws, client := webSocketPipe()
+		go func(frames [][]byte) {
+			for _, frame := range frames {
+				if _, err := client.Write(frame); err != nil {
+					return
+				}
+			}
+		}(test.frames)
+
+		opcode, message, err := ws.ReadMessage()
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: accepted", test.name)
+			}
+		} else if err != nil || opcode != test.opcode || !bytes.Equal(message, test.message) {
+			t.Errorf("%s: got %#x %q, %v", test.name, opcode, message, err)
+		}
+
+		ws.conn.Close()
+		client.Close()
+	}
+}
+
+func TestWebSocketPing(t *testing.T) {
+	ws, client := webSocketPipe()
+	defer client.Close()
+
+	pong := make(chan []byte, 1)
+	go func() {
+		client.Write(clientFrame(true, wsOpPing, []byte("are you there"), 0, true))
+		header, payload, err := readServerFrame(client)
+		if err != nil || header != 0x80|wsOpPong {
+			payload = nil
+		}
+		pong <- payload
+		client.Write(clientFrame(true, wsOpText, []byte("move"), 0, true))
+	}()
+
+	if _, message, err := ws.ReadMessage(); err != nil || string(message) != "move" {
+		t.Errorf("got %q, %v", message, err)
+	}
+	if payload := <-pong; string(payload) != "are you there" {
+		t.Errorf("pong %q", payload)
+	}
+}
+
+func TestWebSocketClose(t *testing.T) {
+	ws, client := webSocketPipe()
+	defer client.Close()
+
+	echo := make(chan []byte, 1)
+	go func() {
+		client.Write(clientFrame(true, wsOpClose, []byte{0x03, 0xe9}, 0, true))
+		header, payload, err := readServerFrame(client)
+		if err != nil || header != 0x80|wsOpClose {
+			payload = nil
+		}
+		echo <- payload
+	}()
+
+	if _, _, err := ws.ReadMessage(); err != io.EOF {
+		t.Errorf("got %v, expected EOF", err)
+	}
+	if payload := <-echo; !bytes.Equal(payload, []byte{0x03, 0xe9}) {
+		t.Errorf("close echoed as %v", payload)
+	}
+
+	/* Nothing is sent after the closing handshake */
+	if err := ws.WriteText([]byte("late")); err == nil {
+		t.Error("wrote after close")
+	}
+}
+
+/* Messages are written with the shortest length encoding */
+func TestWebSocketWriteLength(t *testing.T) {
+	for _, length := range []int{0, 125, 126, 0xffff, 0x10000} {
+		ws, client := webSocketPipe()
+		message := []byte(strings.Repeat("x", length))
+
+		received := make(chan []byte, 1)
+		go func() {
+			var start [2]byte
+			io.ReadFull(client, start[:])
+			rest, _ := io.ReadAll(client)
+			received <- append(start[:], rest...)
+		}()
+		ws.WriteText(message)
+		ws.conn.Close()
+		frame := <-received
+
+		header := 2
+		switch {
+		case length > 0xffff:
+			header += 8
+		case length > 125:
+			header += 2
+		}
+		if len(frame) != header+length {
+			t.Errorf("%d bytes: frame of %d bytes, expected %d", length, len(frame), header+length)
+			continue
+		}
+		if _, payload, err := readServerFrame(bytes.NewReader(frame)); err != nil || !bytes.Equal(payload, message) {
+			t.Errorf("%d bytes: read back %d bytes, %v", length, len(payload), err)
+		}
+		client.Close()
+	}
+}
+
+/* A watcher that stops reading is dropped without holding up the game or
+ * the other watchers, which get every event in order.
+ */
+func TestBroadcastSlowWatcher(t *testing.T) {
+	_, session, _ := NewGameStore().Create("", DifficultyLevels[0])
+	fast, fastClient := webSocketPipe()
+	slow, slowClient := webSocketPipe()
+	defer fastClient.Close()
+	defer slowClient.Close()
+	session.watch(fast, []byte(`"state"`))
+	session.watch(slow, []byte(`"state"`))
+
+	/* Text messages as received by the fast client, until it is closed */
+	received := make(chan string)
+	go func() {
+		defer close(received)
+		for {
+			header, payload, err := readServerFrame(fastClient)
+			if err != nil || header != 0x80|wsOpText {
+				return
+			}
+			received <- string(payload)
+		}
+	}()
+	if message := <-received; message != `"state"` {
+		t.Fatalf("first message %s", message)
+	}
+
+	start := time.Now()
+	for i := 0; i <= watcherQueueSize+1; i++ {
+		session.broadcast(i)
+		if message := <-received; message != strconv.Itoa(i) {
+			t.Fatalf("message %s, expected %d", message, i)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("broadcasting took %v", elapsed)
+	}
+
+	session.watchMutex.Lock()
+	_, fastWatching := session.watchers[fast]
+	_, slowWatching := session.watchers[slow]
+	session.watchMutex.Unlock()
+	if !fastWatching || slowWatching {
+		t.Errorf("watching: fast %t, slow %t", fastWatching, slowWatching)
+	}
+
+	/* Deleting the game closes the remaining connections */
+	session.disconnectWatchers()
+	if message, ok := <-received; ok {
+		t.Errorf("message %s after disconnecting", message)
+	}
+}